@@ -0,0 +1,354 @@
+package redact
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces every redacted value unless MaskWith says otherwise.
+const Mask = "[REDACTED]"
+
+// Tag marks struct fields whose value is never displayed, as in
+// `redact:"true"`.
+const Tag = "redact"
+
+// Policy decides what is masked when requests, responses and errors are
+// rendered for logs or debugging. It never changes what is sent upstream.
+// The zero Policy is Default().
+type Policy struct {
+	headers    []string
+	query      []string
+	json_paths [][]string
+	mask       string
+
+	query_re  *regexp.Regexp
+	header_re *regexp.Regexp
+}
+
+type PolicyOptions func(Policy) Policy
+
+// Headers adds header names, matched case-insensitively, to the deny-list.
+func Headers(names ...string) PolicyOptions {
+	return func(p Policy) Policy {
+		for _, name := range names {
+			p.headers = append(p.headers, http.CanonicalHeaderKey(name))
+		}
+		return p
+	}
+}
+
+// Query adds query parameter names, matched case-insensitively, whose
+// values are masked.
+func Query(params ...string) PolicyOptions {
+	return func(p Policy) Policy {
+		for _, param := range params {
+			p.query = append(p.query, strings.ToLower(param))
+		}
+		return p
+	}
+}
+
+// JSONPaths masks the values found at dot separated paths of JSON bodies,
+// such as "user.email". A "*" segment matches every key or array element, as
+// in "cards.*.number".
+func JSONPaths(paths ...string) PolicyOptions {
+	return func(p Policy) Policy {
+		for _, path := range paths {
+			path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+			p.json_paths = append(p.json_paths, strings.Split(path, "."))
+		}
+		return p
+	}
+}
+
+func MaskWith(mask string) PolicyOptions {
+	return func(p Policy) Policy {
+		p.mask = mask
+		return p
+	}
+}
+
+// New returns a policy masking the well known credential headers and query
+// parameters, extended by opts.
+func New(opts ...PolicyOptions) Policy {
+	p := Policy{mask: Mask}
+	p = Headers(
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+		"X-Api-Key", "X-Amz-Security-Token", "X-Signature",
+	)(p)
+	p = Query(
+		"access_token", "api_key", "apikey", "key", "token", "password", "secret",
+		"signature", "X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token",
+	)(p)
+
+	for _, opt := range opts {
+		p = opt(p)
+	}
+
+	quote := func(names []string) string {
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = regexp.QuoteMeta(name)
+		}
+		return strings.Join(quoted, "|")
+	}
+	p.query_re = regexp.MustCompile(`(?i)((?:^|[?&;\s"'])(?:` + quote(p.query) + `)=)[^&\s"'#]*`)
+	p.header_re = regexp.MustCompile(`(?i)(\b(?:` + quote(p.headers) + `)\s*[:=]\s*)[^\r\n,;"']+|(\bBearer\s+)[\w\-.~+/]+=*`)
+
+	return p
+}
+
+var global atomic.Pointer[Policy]
+
+// Default is the policy used by renderers that are not given one. It is New()
+// until SetDefault replaces it.
+func Default() Policy {
+	if p := global.Load(); p != nil {
+		return *p
+	}
+	return New()
+}
+
+// SetDefault replaces the default policy. The zero Policy restores New().
+func SetDefault(p Policy) {
+	if p.query_re == nil {
+		p = New()
+	}
+	global.Store(&p)
+}
+
+// orDefault is p, or Default() when p was not built by New.
+func (p Policy) orDefault() Policy {
+	if p.query_re == nil {
+		return Default()
+	}
+	return p
+}
+
+func (p Policy) maskHeader(name string) bool {
+	return slices.Contains(p.headers, http.CanonicalHeaderKey(name))
+}
+
+func (p Policy) maskQuery(name string) bool {
+	return slices.Contains(p.query, strings.ToLower(name))
+}
+
+// Header returns a copy of h with the denied values masked.
+func (p Policy) Header(h http.Header) http.Header {
+	p = p.orDefault()
+	out := h.Clone()
+	for name, values := range out {
+		if !p.maskHeader(name) {
+			continue
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = p.mask
+		}
+		out[name] = masked
+	}
+
+	return out
+}
+
+// URL masks denied query parameters and the userinfo password of raw.
+// Anything that does not parse is handled as Text.
+func (p Policy) URL(raw string) string {
+	p = p.orDefault()
+	u, err := url.Parse(raw)
+	if err != nil {
+		return p.Text(raw)
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), p.mask)
+	}
+
+	if u.RawQuery != "" {
+		parts := strings.Split(u.RawQuery, "&")
+		for i, part := range parts {
+			name, _, ok := strings.Cut(part, "=")
+			if decoded, err := url.QueryUnescape(name); err == nil {
+				name = decoded
+			}
+			if ok && p.maskQuery(name) {
+				parts[i] = url.QueryEscape(name) + "=" + url.QueryEscape(p.mask)
+			}
+		}
+		u.RawQuery = strings.Join(parts, "&")
+	}
+
+	return u.String()
+}
+
+// JSON masks the configured paths of a JSON document. A document that does
+// not parse, e.g. one cut at a size cap, is masked whole since the paths can
+// not be found in it. Other content goes through Text.
+func (p Policy) JSON(b []byte) []byte {
+	p = p.orDefault()
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return []byte(p.Text(string(b)))
+	}
+	if len(p.json_paths) == 0 {
+		return b
+	}
+
+	var tree any
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return []byte(p.mask)
+	}
+
+	masked, err := json.Marshal(p.maskPaths(tree))
+	if err != nil {
+		return b
+	}
+	return masked
+}
+
+// Text masks denied query parameters, denied headers written as
+// "Name: value" and bearer tokens found in free text such as error messages.
+func (p Policy) Text(s string) string {
+	p = p.orDefault()
+	s = p.query_re.ReplaceAllString(s, "${1}"+p.mask)
+	return p.header_re.ReplaceAllStringFunc(s, func(match string) string {
+		groups := p.header_re.FindStringSubmatch(match)
+		if groups[1] != "" {
+			return groups[1] + p.mask
+		}
+		return groups[2] + p.mask
+	})
+}
+
+// Encode renders v as JSON for display. Struct fields tagged `redact:"true"`
+// and values at the configured JSON paths are masked.
+func (p Policy) Encode(v any) string {
+	p = p.orDefault()
+	b, err := json.Marshal(p.maskPaths(p.tree(reflect.ValueOf(v))))
+	if err != nil {
+		return fmt.Sprintf("%%!(%v)", err)
+	}
+	return string(b)
+}
+
+var (
+	marshalerType     = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// tree converts v into maps, slices and scalars, masking tagged fields on
+// the way.
+func (p Policy) tree(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Type().Implements(marshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return p.tree(v.Elem())
+
+	case reflect.Struct:
+		out := map[string]any{}
+		for _, field := range reflect.VisibleFields(v.Type()) {
+			if !field.IsExported() || field.Anonymous {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			value, err := v.FieldByIndexErr(field.Index)
+			if err != nil {
+				continue
+			}
+			if strings.Contains(opts, "omitempty") && value.IsZero() {
+				continue
+			}
+
+			if field.Tag.Get(Tag) == "true" {
+				out[name] = p.mask
+				continue
+			}
+			out[name] = p.tree(value)
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := map[string]any{}
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = p.tree(iter.Value())
+		}
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = p.tree(v.Index(i))
+		}
+		return out
+	}
+
+	return v.Interface()
+}
+
+func (p Policy) maskPaths(tree any) any {
+	for _, path := range p.json_paths {
+		tree = p.maskPath(tree, path)
+	}
+	return tree
+}
+
+func (p Policy) maskPath(node any, path []string) any {
+	if len(path) == 0 {
+		return p.mask
+	}
+
+	head, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]any:
+		for key, value := range n {
+			if head == "*" || head == key {
+				n[key] = p.maskPath(value, rest)
+			}
+		}
+	case []any:
+		for i, value := range n {
+			if head == "*" || head == fmt.Sprint(i) {
+				n[i] = p.maskPath(value, rest)
+			}
+		}
+	}
+
+	return node
+}
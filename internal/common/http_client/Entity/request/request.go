@@ -5,15 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/sakamotoryou/api-agg-two/internal/common/helper"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/redact"
 )
 
 var (
 	ErrJsonEncode           = errors.New("request body has fail to encoded to json.")
 	ErrUnknownContentEncode = errors.New("request body has fail to encoded as content type is unknown.")
+	ErrFormBodyInvalidType  = errors.New("form body has to be a struct or a map")
 )
 
 type RawRequestData struct {
@@ -30,28 +35,55 @@ func (d RawRequestData) GetParam() any {
 }
 
 func (d RawRequestData) encodeParam() string {
-	s := strings.Builder{}
-	struct_val := reflect.ValueOf(d.param)
-	t := reflect.VisibleFields(reflect.TypeOf(d.param))
-	for i, v := range t {
-		if i != 0 {
-			s.WriteString("&")
+	struct_val := indirect(d.param)
+	if struct_val.Kind() == reflect.Map {
+		return encodeMap(struct_val).Encode()
+	}
+
+	values := url.Values{}
+	eachField(struct_val, func(f reflect.StructField, field reflect.Value) {
+		values.Set(strings.ToLower(f.Name), fmt.Sprintf("%v", field))
+	})
+
+	return values.Encode()
+}
+
+// eachField calls fn with every visible field of a struct, promoted fields of
+// embedded structs included. Pointers are dereferenced and nil ones skipped.
+func eachField(struct_val reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	for _, f := range reflect.VisibleFields(struct_val.Type()) {
+		t := f.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if f.Anonymous && t.Kind() == reflect.Struct {
+			continue
 		}
 
-		var deref_data reflect.Value
-		switch struct_val.Field(i).Kind() {
-		case reflect.Pointer:
-			deref_data = struct_val.Field(i).Elem()
-		default:
-			deref_data = struct_val.Field(i)
+		field, err := struct_val.FieldByIndexErr(f.Index)
+		if err != nil {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
 		}
 
-		s.WriteString(strings.ToLower(v.Name))
-		s.WriteString("=")
-		s.WriteString(fmt.Sprintf("%v", deref_data))
+		fn(f, field)
 	}
+}
 
-	return s.String()
+// encodeMap formats the values of a map with string keys.
+func encodeMap(m reflect.Value) url.Values {
+	values := url.Values{}
+	iter := m.MapRange()
+	for iter.Next() {
+		values.Set(fmt.Sprintf("%v", iter.Key()), fmt.Sprintf("%v", iter.Value()))
+	}
+
+	return values
 }
 
 func (d RawRequestData) encodeBody(content_type string) (string, error) {
@@ -62,11 +94,45 @@ func (d RawRequestData) encodeBody(content_type string) (string, error) {
 			return "", fmt.Errorf("%w:%v", ErrJsonEncode, err)
 		}
 		return string(encoded_json), nil
+	case "application/x-www-form-urlencoded":
+		return d.encodeForm()
 	}
 
 	return "", ErrUnknownContentEncode
 }
 
+// encodeForm encodes the body fields using their `form` tag, falling back to
+// the lower cased field name. A tag ending in ",omitempty" skips zero values.
+// Maps are encoded key by key.
+func (d RawRequestData) encodeForm() (string, error) {
+	struct_val := indirect(d.body)
+	switch struct_val.Kind() {
+	case reflect.Map:
+		return encodeMap(struct_val).Encode(), nil
+	case reflect.Struct:
+	default:
+		return "", fmt.Errorf("%w:%s", ErrFormBodyInvalidType, struct_val.Kind())
+	}
+
+	values := url.Values{}
+	eachField(struct_val, func(f reflect.StructField, field reflect.Value) {
+		name, opt, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "-" {
+			return
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if opt == "omitempty" && field.IsZero() {
+			return
+		}
+
+		values.Set(name, fmt.Sprintf("%v", field))
+	})
+
+	return values.Encode(), nil
+}
+
 type RawRequestDataSetter func(RawRequestData) RawRequestData
 
 func SetRequestParam(data any) RawRequestDataSetter {
@@ -108,6 +174,7 @@ type Request struct {
 	path     string
 	method   string
 	header   requestHeaders
+	query    url.Values
 	raw_data RawRequestData
 
 	// Processed request
@@ -136,11 +203,24 @@ func (r Request) GetContentType() string {
 	return r.header.Get("Content-Type").value
 }
 
+// EncodeUrl joins the query parameters and the encoded Param after the path.
 func (r Request) EncodeUrl() string {
 	s := strings.Builder{}
 	s.WriteString(r.domain)
 	s.WriteString(r.path)
-	s.WriteString(r.param)
+
+	query := r.query.Encode()
+	if r.param != "" {
+		if query != "" {
+			query += "&"
+		}
+		query += r.param
+	}
+	if query != "" {
+		s.WriteString("?")
+		s.WriteString(query)
+	}
+
 	return s.String()
 }
 
@@ -168,6 +248,20 @@ func (r Request) GetHeader(key string) string {
 	return ""
 }
 
+// GetHeaders returns a copy of every header set on the request.
+func (r Request) GetHeaders() http.Header {
+	h := make(http.Header, len(r.header))
+	for _, value := range r.header {
+		h.Add(value.key, value.value)
+	}
+
+	return h
+}
+
+func (r Request) GetQuery(key string) string {
+	return r.query.Get(key)
+}
+
 func (r Request) GetUrl() string {
 	return r.url
 }
@@ -188,6 +282,31 @@ func (r Request) GetBodyReader() io.Reader {
 	return strings.NewReader(r.GetBody())
 }
 
+// Dump renders the request for logs and debugging with the default
+// redaction policy.
+func (r Request) Dump() string {
+	return r.DumpWith(redact.Default())
+}
+
+// DumpWith renders the request with p applied to the URL, the headers and
+// the raw param and body, so fields tagged `redact:"true"` never show up.
+func (r Request) DumpWith(p redact.Policy) string {
+	s := strings.Builder{}
+	s.WriteString(r.method + " " + p.URL(r.url) + "\n")
+
+	header := p.Header(r.GetHeaders())
+	header.Write(&s)
+
+	if !helper.IsInterfaceNil(r.raw_data.param) {
+		s.WriteString("\nParam: " + p.Encode(r.raw_data.param))
+	}
+	if !helper.IsInterfaceNil(r.raw_data.body) {
+		s.WriteString("\nBody: " + p.Encode(r.raw_data.body))
+	}
+
+	return s.String()
+}
+
 type RequestOptions func(Request) Request
 
 func Domain(domain string) RequestOptions {
@@ -239,19 +358,28 @@ func Patch() RequestOptions {
 	}
 }
 
-// func Head() RequestOptions {
-// 	return func(o Request) Request {
-// 		o.method = "HEAD"
-// 		return o
-// 	}
-// }
-//
-// func Options() RequestOptions {
-// 	return func(o Request) Request {
-// 		o.method = "OPTIONS"
-// 		return o
-// 	}
-// }
+func Head() RequestOptions {
+	return func(o Request) Request {
+		o.method = "HEAD"
+		return o
+	}
+}
+
+func Options() RequestOptions {
+	return func(o Request) Request {
+		o.method = "OPTIONS"
+		return o
+	}
+}
+
+// Method sets any method, e.g. "PROPFIND" or "QUERY". It is used as given,
+// methods being case sensitive, and must be an RFC 7230 token.
+func Method(method string) RequestOptions {
+	return func(o Request) Request {
+		o.method = method
+		return o
+	}
+}
 
 func Header(headers ...requestHeader) RequestOptions {
 	return func(o Request) Request {
@@ -271,6 +399,32 @@ func Header(headers ...requestHeader) RequestOptions {
 	}
 }
 
+// Query sets the query parameter key, replacing any value set before.
+func Query(key, value string) RequestOptions {
+	return func(o Request) Request {
+		q := make(url.Values, len(o.query)+1)
+		for k, v := range o.query {
+			q[k] = v
+		}
+		q.Set(key, value)
+
+		o.query = q
+		return o
+	}
+}
+
+// Queries replaces every query parameter set before with q.
+func Queries(q url.Values) RequestOptions {
+	return func(o Request) Request {
+		o.query = make(url.Values, len(q))
+		for k, v := range q {
+			o.query[k] = slices.Clone(v)
+		}
+
+		return o
+	}
+}
+
 func Param(param any) RequestOptions {
 	return func(o Request) Request {
 		newParam := SetRequestParam(param)
@@ -301,6 +455,20 @@ func Json(body any) RequestOptions {
 	}
 }
 
+func Form(body any) RequestOptions {
+	return func(o Request) Request {
+		o = Header(
+			SetRequestHeader("Content-Type", "application/x-www-form-urlencoded"),
+		)(o)
+
+		if body != nil {
+			o = Body(body)(o)
+		}
+
+		return o
+	}
+}
+
 func Prepare(opts ...RequestOptions) func() (Request, error) {
 	return func() (Request, error) {
 		return Build(opts...)
@@ -328,13 +496,17 @@ func Build(opts ...RequestOptions) (Request, error) {
 
 var (
 	ErrDomainNameEmpty                 = errors.New("empty domain name")
+	ErrDomainInvalid                   = errors.New("domain has to be an absolute url with a scheme and a host")
 	ErrPathEmpty                       = errors.New("empty url path")
+	ErrPathInvalid                     = errors.New("url path has to start with /")
 	ErrRequestMethodEmpty              = errors.New("empty Request method")
+	ErrRequestMethodInvalid            = errors.New("request method is not a valid token")
 	ErrUnexpectNilAssignedResponseData = errors.New("expect type struct")
-	ErrRequestParamInvalidType         = errors.New("expect request parameter to be struct")
-	ErrRequestBodyInvalidType          = errors.New("expect request body to be struct")
+	ErrRequestParamInvalidType         = errors.New("expect request parameter to be a struct or a map")
+	ErrRequestBodyInvalidType          = errors.New("expect request body to be a struct, a map, a slice or json.RawMessage")
 )
 
+// checkOptions runs every check and returns all their errors joined.
 func checkOptions(req Request) error {
 	checks := []checkFunc{
 		checkDomain(),
@@ -343,13 +515,14 @@ func checkOptions(req Request) error {
 		checkRequest(),
 	}
 
+	var errs []error
 	for _, check := range checks {
 		if err := check(req); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 type checkFunc func(req Request) error
@@ -360,6 +533,14 @@ func checkDomain() checkFunc {
 			return ErrDomainNameEmpty
 		}
 
+		u, err := url.Parse(req.domain)
+		if err != nil {
+			return fmt.Errorf("%w:%v", ErrDomainInvalid, err)
+		}
+		if !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("%w:%q", ErrDomainInvalid, req.domain)
+		}
+
 		return nil
 	}
 }
@@ -370,6 +551,10 @@ func checkPath() checkFunc {
 			return ErrPathEmpty
 		}
 
+		if !strings.HasPrefix(req.path, "/") {
+			return fmt.Errorf("%w:%q", ErrPathInvalid, req.path)
+		}
+
 		return nil
 	}
 }
@@ -380,10 +565,28 @@ func checkMethod() checkFunc {
 			return ErrRequestMethodEmpty
 		}
 
+		if !isToken(req.method) {
+			return fmt.Errorf("%w:%q", ErrRequestMethodInvalid, req.method)
+		}
+
 		return nil
 	}
 }
 
+// isToken reports whether s is a token as defined by RFC 7230 section 3.2.6.
+func isToken(s string) bool {
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 func checkRequest() checkFunc {
 	return func(req Request) error {
 		if err := requestDataValidate(req); err != nil {
@@ -395,24 +598,46 @@ func checkRequest() checkFunc {
 }
 
 func requestDataValidate(req Request) error {
-	if ok := helper.IsInterfaceNil(req.GetRawRequestData().GetParam()); !ok {
-		if reflect.TypeOf(req.raw_data.param).Kind() != reflect.Struct {
-			return ErrRequestParamInvalidType
+	var errs []error
+	if param := req.GetRawRequestData().GetParam(); !helper.IsInterfaceNil(param) {
+		switch kindOf(param) {
+		case reflect.Struct, reflect.Map:
+			errs = append(errs, validate("param", param))
+		default:
+			errs = append(errs, ErrRequestParamInvalidType)
 		}
 	}
 
-	if ok := helper.IsInterfaceNil(req.GetRawRequestData().GetBody()); !ok {
-		if reflect.TypeOf(req.raw_data.body).Kind() != reflect.Struct {
-			return ErrRequestBodyInvalidType
+	if body := req.GetRawRequestData().GetBody(); !helper.IsInterfaceNil(body) {
+		switch kindOf(body) {
+		case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+			errs = append(errs, validate("body", body))
+		default:
+			errs = append(errs, ErrRequestBodyInvalidType)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// kindOf is the kind of v once pointers are followed, Invalid for a nil
+// pointer.
+func kindOf(v any) reflect.Kind {
+	return indirect(v).Kind()
+}
+
+func indirect(v any) reflect.Value {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Pointer {
+		val = val.Elem()
+	}
+
+	return val
 }
 
 func process(req Request) (func() Request, error) {
-	req.url = req.EncodeUrl()
 	req.param = req.EncodeParam()
+	req.url = req.EncodeUrl()
 
 	body, err := req.EncodeBody()
 	if err != nil {
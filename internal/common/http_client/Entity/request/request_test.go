@@ -1,6 +1,7 @@
 package request_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
@@ -19,7 +20,7 @@ func TestRequestDataOperation(t *testing.T) {
 			TestParam{number: 123, decimal: &dd},
 		)(request.Request{})
 		result := newReq.EncodeParam()
-		assert.Equal(t, "number=123&decimal=12.33", result)
+		assert.Equal(t, "decimal=12.33&number=123", result)
 	})
 
 	t.Run("Encode body", func(t *testing.T) {
@@ -36,6 +37,20 @@ func TestRequestDataOperation(t *testing.T) {
 		assert.Equal(t, `{"number":123,"decimal":12.33}`, result)
 	})
 
+	t.Run("Encode form body", func(t *testing.T) {
+		type TestForm struct {
+			GrantType string `form:"grant_type"`
+			Scope     string `form:"scope,omitempty"`
+			Secret    string `form:"-"`
+		}
+		newReq := request.Form(
+			TestForm{GrantType: "client_credentials", Secret: "hidden"},
+		)(request.Request{})
+		result, err := newReq.EncodeBody()
+		assert.NoError(t, err)
+		assert.Equal(t, "grant_type=client_credentials", result)
+	})
+
 	t.Run("Encode body with empty 'Content-Type'", func(t *testing.T) {
 		type TestBody struct {
 			Number  int      `json:"number"`
@@ -50,6 +65,33 @@ func TestRequestDataOperation(t *testing.T) {
 	})
 }
 
+func TestRequestDump(t *testing.T) {
+	t.Run("Dump masks sensitive data", func(t *testing.T) {
+		type Credentials struct {
+			User     string `json:"user"`
+			Password string `json:"password" redact:"true"`
+		}
+
+		newReq, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Post(),
+			request.Path("/api/v1/login?api_key=k1"),
+			request.Header(
+				request.SetRequestHeader("Authorization", "Bearer abc"),
+			),
+			request.Json(Credentials{"alice", "hunter2"}),
+		)
+		assert.NoError(t, err)
+
+		dump := newReq.Dump()
+		assert.Contains(t, dump, "POST https://example.com/api/v1/login?api_key=%5BREDACTED%5D")
+		assert.Contains(t, dump, "Authorization: [REDACTED]")
+		assert.Contains(t, dump, `Body: {"password":"[REDACTED]","user":"alice"}`)
+		assert.NotContains(t, dump, "hunter2")
+		assert.NotContains(t, dump, "abc")
+	})
+}
+
 func TestRequestOptions(t *testing.T) {
 	t.Run("Domain Option", func(t *testing.T) {
 		newReq := request.Domain("example.com")
@@ -86,15 +128,20 @@ func TestRequestOptions(t *testing.T) {
 		assert.Equal(t, "PATCH", newReq(request.Request{}).GetMethod())
 	})
 
-	// t.Run("Head Method", func(t *testing.T) {
-	// 	newReq := request.Head()
-	// 	assert.Equal(t, "HEAD", newReq(request.Request{}).GetMethod())
-	// })
-	//
-	// t.Run("Options Method", func(t *testing.T) {
-	// 	newReq := request.Options()
-	// 	assert.Equal(t, "OPTIONS", newReq(request.Request{}).GetMethod())
-	// })
+	t.Run("Head Method", func(t *testing.T) {
+		newReq := request.Head()
+		assert.Equal(t, "HEAD", newReq(request.Request{}).GetMethod())
+	})
+
+	t.Run("Options Method", func(t *testing.T) {
+		newReq := request.Options()
+		assert.Equal(t, "OPTIONS", newReq(request.Request{}).GetMethod())
+	})
+
+	t.Run("Arbitrary Method", func(t *testing.T) {
+		newReq := request.Method("PROPFIND")
+		assert.Equal(t, "PROPFIND", newReq(request.Request{}).GetMethod())
+	})
 
 	t.Run("Http Header", func(t *testing.T) {
 		newReq := request.Header(
@@ -106,6 +153,33 @@ func TestRequestOptions(t *testing.T) {
 		assert.Equal(t, "", newReq(request.Request{}).GetHeader("non-existent"))
 	})
 
+	t.Run("Query parameters", func(t *testing.T) {
+		newReq, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("/api/v1"),
+			request.Query("lang", "en"),
+			request.Query("page", "1"),
+			request.Query("lang", "fr"),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "fr", newReq.GetQuery("lang"))
+		assert.Equal(t, "https://example.com/api/v1?lang=fr&page=1", newReq.GetUrl())
+
+		type Page struct {
+			Page int
+		}
+		newReq, err = request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("/api/v1"),
+			request.Query("lang", "en"),
+			request.Param(Page{2}),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/api/v1?lang=en&page=2", newReq.GetUrl())
+	})
+
 	t.Run("Set request parameter", func(t *testing.T) {
 		type RequestParam struct {
 			id  string
@@ -132,7 +206,7 @@ func TestRequestOptions(t *testing.T) {
 
 	t.Run("Combination of Domain, Path, and Get", func(t *testing.T) {
 		newReq, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Get(),
 			request.Path("/api/v1"),
 			request.Header(
@@ -141,7 +215,7 @@ func TestRequestOptions(t *testing.T) {
 			),
 		)
 		assert.NoError(t, err)
-		assert.Equal(t, "example.com", newReq.GetDomain())
+		assert.Equal(t, "https://example.com", newReq.GetDomain())
 		assert.Equal(t, "/api/v1", newReq.GetPath())
 		assert.Equal(t, "GET", newReq.GetMethod())
 		assert.Equal(t, "application/json", newReq.GetHeader("Content-Type"))
@@ -160,7 +234,7 @@ func TestRequestOptions(t *testing.T) {
 		}
 
 		newReq, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Get(),
 			request.Path("/api/v1"),
 			request.Header(
@@ -170,7 +244,7 @@ func TestRequestOptions(t *testing.T) {
 			request.Json(RequestBody{"body", 9.99}),
 		)
 		assert.NoError(t, err)
-		assert.Equal(t, "example.com", newReq.GetDomain())
+		assert.Equal(t, "https://example.com", newReq.GetDomain())
 		assert.Equal(t, "/api/v1", newReq.GetPath())
 		assert.Equal(t, "GET", newReq.GetMethod())
 		assert.Equal(t, "application/json", newReq.GetHeader("Content-Type"))
@@ -191,7 +265,7 @@ func TestRequestOptions(t *testing.T) {
 
 	t.Run("Missing method option", func(t *testing.T) {
 		_, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Path("/api/v1"),
 		)
 
@@ -199,9 +273,21 @@ func TestRequestOptions(t *testing.T) {
 		assert.ErrorIs(t, err, request.ErrRequestMethodEmpty)
 	})
 
+	t.Run("Invalid method option", func(t *testing.T) {
+		for _, method := range []string{"GET /", "QUERY\n", "(GET)", "GÉT"} {
+			_, err := request.Build(
+				request.Domain("https://example.com"),
+				request.Path("/api/v1"),
+				request.Method(method),
+			)
+
+			assert.ErrorIs(t, err, request.ErrRequestMethodInvalid, method)
+		}
+	})
+
 	t.Run("Missing path option", func(t *testing.T) {
 		_, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Get(),
 		)
 
@@ -211,7 +297,7 @@ func TestRequestOptions(t *testing.T) {
 
 	t.Run("Request Param is not a struct", func(t *testing.T) {
 		_, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Get(),
 			request.Path("/api/v1"),
 			request.Param("some string"),
@@ -223,7 +309,7 @@ func TestRequestOptions(t *testing.T) {
 
 	t.Run("Empty request param", func(t *testing.T) {
 		_, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Path("/api/v1"),
 			request.Get(),
 			request.Json(
@@ -240,7 +326,7 @@ func TestRequestOptions(t *testing.T) {
 
 	t.Run("Request Body is not a struct", func(t *testing.T) {
 		_, err := request.Build(
-			request.Domain("example.com"),
+			request.Domain("https://example.com"),
 			request.Get(),
 			request.Path("/api/v1"),
 			request.Body("some string"),
@@ -251,10 +337,195 @@ func TestRequestOptions(t *testing.T) {
 	})
 
 	t.Run("Empty request body", func(t *testing.T) {
+		_, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("/api/v1"),
+		)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestRequestValidation(t *testing.T) {
+	t.Run("Domain has to be an absolute url", func(t *testing.T) {
+		for _, domain := range []string{"example.com", "/api", "https://", "ht tp://example.com"} {
+			_, err := request.Build(
+				request.Domain(domain),
+				request.Get(),
+				request.Path("/api/v1"),
+			)
+
+			assert.ErrorIs(t, err, request.ErrDomainInvalid, domain)
+		}
+	})
+
+	t.Run("Path has to start with a slash", func(t *testing.T) {
+		_, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("api/v1"),
+		)
+
+		assert.ErrorIs(t, err, request.ErrPathInvalid)
+	})
+
+	t.Run("Every failed check is returned", func(t *testing.T) {
 		_, err := request.Build(
 			request.Domain("example.com"),
+			request.Path("api/v1"),
+			request.Body("some string"),
+		)
+
+		assert.ErrorIs(t, err, request.ErrDomainInvalid)
+		assert.ErrorIs(t, err, request.ErrPathInvalid)
+		assert.ErrorIs(t, err, request.ErrRequestMethodEmpty)
+		assert.ErrorIs(t, err, request.ErrRequestBodyInvalidType)
+	})
+
+	t.Run("Bodies may be maps, slices, pointers and raw json", func(t *testing.T) {
+		type Item struct {
+			Name string `json:"name"`
+		}
+
+		tests := []struct {
+			body   any
+			expect string
+		}{
+			{map[string]int{"a": 1}, `{"a":1}`},
+			{[]Item{{"first"}, {"second"}}, `[{"name":"first"},{"name":"second"}]`},
+			{&Item{"pointer"}, `{"name":"pointer"}`},
+			{json.RawMessage(`{"raw":true}`), `{"raw":true}`},
+		}
+
+		for _, test := range tests {
+			newReq, err := request.Build(
+				request.Domain("https://example.com"),
+				request.Post(),
+				request.Path("/api/v1"),
+				request.Json(test.body),
+			)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expect, newReq.GetBody())
+		}
+	})
+
+	t.Run("Nil pointer body is refused", func(t *testing.T) {
+		type Item struct{}
+		var item *Item
+
+		_, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Post(),
+			request.Path("/api/v1"),
+			request.Body(item),
+		)
+
+		assert.ErrorIs(t, err, request.ErrRequestBodyInvalidType)
+	})
+
+	t.Run("Params are added to the url query", func(t *testing.T) {
+		type Page struct {
+			Page int
+		}
+
+		newReq, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("/api/v1"),
+			request.Query("lang", "en"),
+			request.Param(&Page{2}),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/api/v1?lang=en&page=2", newReq.GetUrl())
+
+		newReq, err = request.Build(
+			request.Domain("https://example.com"),
+			request.Get(),
+			request.Path("/api/v1"),
+			request.Param(map[string]string{"b": "2", "a": "1"}),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/api/v1?a=1&b=2", newReq.GetUrl())
+	})
+
+	t.Run("Struct params are query escaped", func(t *testing.T) {
+		type Paging struct {
+			Page int
+		}
+		type Search struct {
+			Paging
+			Term   string
+			Cursor *string
+		}
+
+		newReq, err := request.Build(
+			request.Domain("https://example.com"),
 			request.Get(),
 			request.Path("/api/v1"),
+			request.Param(Search{Paging: Paging{3}, Term: "a&b=c #d"}),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/api/v1?page=3&term=a%26b%3Dc+%23d", newReq.GetUrl())
+	})
+
+	t.Run("Validate tags report every violation", func(t *testing.T) {
+		type Item struct {
+			Name string `json:"name" validate:"required"`
+		}
+		type Order struct {
+			Id       string  `json:"id" validate:"required,min=3"`
+			Quantity int     `json:"quantity" validate:"min=1,max=10"`
+			Status   string  `json:"status" validate:"oneof=new paid"`
+			Note     *string `json:"note" validate:"max=5"`
+			Items    []Item  `json:"items" validate:"required"`
+		}
+		type Filter struct {
+			Limit int `validate:"max=100"`
+		}
+
+		_, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Post(),
+			request.Path("/api/v1/orders"),
+			request.Param(Filter{500}),
+			request.Json(Order{
+				Id:       "ab",
+				Quantity: 0,
+				Status:   "lost",
+				Items:    []Item{{"ok"}, {}},
+			}),
+		)
+
+		assert.ErrorIs(t, err, request.ErrRequestValidation)
+		for _, expect := range []string{
+			`param.Limit fails "max=100"`,
+			`body.id fails "min=3"`,
+			`body.quantity fails "min=1"`,
+			`body.status fails "oneof=new paid"`,
+			`body.items[1].name fails "required"`,
+		} {
+			assert.ErrorContains(t, err, expect)
+		}
+		assert.NotContains(t, err.Error(), "body.note")
+
+		var violation request.ValidationError
+		assert.ErrorAs(t, err, &violation)
+		assert.Equal(t, "param.Limit", violation.Field)
+	})
+
+	t.Run("Valid tagged body passes", func(t *testing.T) {
+		type Order struct {
+			Id       string `json:"id" validate:"required,min=3"`
+			Quantity int    `json:"quantity" validate:"min=1,max=10"`
+		}
+
+		_, err := request.Build(
+			request.Domain("https://example.com"),
+			request.Post(),
+			request.Path("/api/v1/orders"),
+			request.Json(&Order{"abc", 2}),
 		)
 
 		assert.NoError(t, err)
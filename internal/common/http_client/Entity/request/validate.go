@@ -0,0 +1,164 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrRequestValidation = errors.New("request validation failed")
+
+// ValidateTag holds the rules checked on param and body fields before any
+// network call, e.g. `validate:"required,min=1"`. The rules are:
+//
+//   - required: the field is not its zero value, or a nil pointer;
+//   - min=N, max=N: bounds the length of strings, slices and maps, and the
+//     value of numbers;
+//   - oneof=a b c: the field formats to one of the listed values.
+//
+// Rules other than required are skipped on nil pointers. Nested structs,
+// and structs in slices and maps, are validated too.
+const ValidateTag = "validate"
+
+// ValidationError is one broken rule. It matches ErrRequestValidation.
+type ValidationError struct {
+	// Field is the path to the field, e.g. "body.items[0].name", named after
+	// the json tag when there is one.
+	Field string
+	Rule  string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s:%s fails %q", ErrRequestValidation, e.Field, e.Rule)
+}
+
+func (e ValidationError) Is(target error) bool {
+	return target == ErrRequestValidation
+}
+
+// validate returns every broken rule of v joined, nil when there is none.
+func validate(name string, v any) error {
+	var errs []error
+	validateValue(name, reflect.ValueOf(v), &errs)
+	return errors.Join(errs...)
+}
+
+func validateValue(path string, v reflect.Value, errs *[]error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			field_path := path + "." + fieldName(f)
+			if f.Anonymous {
+				field_path = path
+			}
+
+			field := v.Field(i)
+			for _, rule := range splitRules(f.Tag.Get(ValidateTag)) {
+				if !checkRule(field, rule) {
+					*errs = append(*errs, ValidationError{field_path, rule})
+				}
+			}
+			validateValue(field_path, field, errs)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := range v.Len() {
+			validateValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), errs)
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(fmt.Sprintf("%s[%v]", path, iter.Key()), iter.Value(), errs)
+		}
+	}
+}
+
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+
+	return name
+}
+
+func splitRules(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+
+	return strings.Split(tag, ",")
+}
+
+func checkRule(v reflect.Value, rule string) bool {
+	name, arg, _ := strings.Cut(rule, "=")
+	if name == "required" {
+		return !v.IsZero()
+	}
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return false
+		}
+
+		size, ok := measure(v)
+		if !ok {
+			return false
+		}
+		if name == "min" {
+			return size >= bound
+		}
+		return size <= bound
+
+	case "oneof":
+		return slices.Contains(strings.Fields(arg), fmt.Sprintf("%v", v))
+	}
+
+	// Unknown rules never pass so that typos do not go unnoticed.
+	return false
+}
+
+// measure is the length of strings, slices and maps, and the value of
+// numbers.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+
+	return 0, false
+}
@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/sakamotoryou/api-agg-two/internal/common/helper"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/redact"
 )
 
 type ResponseFunc func(Response) Response
@@ -21,6 +24,7 @@ type Response struct {
 	body         io.Reader
 	content_type string
 	code         int
+	method       string
 
 	on_success []SuccessResolver
 	on_reject  RejectResolver
@@ -54,6 +58,15 @@ func ResponseStatusCode(status_code int) ResponseFunc {
 	}
 }
 
+// ResponseMethod records the method of the request, which tells whether a
+// body may follow at all.
+func ResponseMethod(method string) ResponseFunc {
+	return func(resp Response) Response {
+		resp.method = method
+		return resp
+	}
+}
+
 func OnSuccess(fns ...SuccessResolver) ResponseFunc {
 	return func(resp Response) Response {
 		resp.on_success = fns
@@ -102,6 +115,28 @@ func (resp Response) GetStatusCode() int {
 	return resp.code
 }
 
+// Bodiless reports whether the response cannot carry a body: the answer to
+// a HEAD request, a 1xx, a 204 or a 304.
+func (resp Response) Bodiless() bool {
+	return resp.method == http.MethodHead ||
+		(resp.code >= 100 && resp.code < 200) ||
+		resp.code == http.StatusNoContent ||
+		resp.code == http.StatusNotModified
+}
+
+// Dump renders the status and headers with the default redaction policy.
+// The body is left out as reading it would consume it.
+func (resp Response) Dump() string {
+	return resp.DumpWith(redact.Default())
+}
+
+func (resp Response) DumpWith(p redact.Policy) string {
+	s := strings.Builder{}
+	s.WriteString(fmt.Sprintf("%d %s\n", resp.code, http.StatusText(resp.code)))
+	p.Header(resp.header).Write(&s)
+	return s.String()
+}
+
 var (
 	ErrHeaderIsEmpty          = errors.New("response header is empty")
 	ErrStatusCodeMissing      = errors.New("response status code is empty")
@@ -148,7 +183,7 @@ func checkStatusCode() responseCheckFunc {
 
 func checkSuccessAction() responseCheckFunc {
 	return func(resp Response) error {
-		if resp.on_success == nil {
+		if resp.on_success == nil && !resp.Bodiless() {
 			return ErrMissingOnSuccessAction
 		}
 
@@ -167,6 +202,18 @@ func Decode(v any) func(Response) ResponseErrorFunc {
 	}
 }
 
+// DecodeOrFail is Decode failing the resolution when the body does not
+// decode, where Decode only stacks the failure.
+func DecodeOrFail(v any) func(Response) ResponseErrorFunc {
+	return func(resp Response) ResponseErrorFunc {
+		if err := resp.decode(v); err != nil {
+			return SetClient("decode response body:" + err.Error())
+		}
+
+		return Skip()
+	}
+}
+
 type ResponseError struct {
 	front_message string
 	stack_message []string
@@ -210,13 +257,19 @@ func Skip() ResponseErrorFunc {
 }
 
 func (r ResponseError) Log() string {
+	return r.LogWith(redact.Default())
+}
+
+// LogWith renders the error with p masking credentials that may have ended
+// up in the messages.
+func (r ResponseError) LogWith(p redact.Policy) string {
 	return fmt.Sprintf(`
     Front Message: %s,
     Stack Message: %s
-    `, r.front_message, func() string {
+    `, p.Text(r.front_message), func() string {
 		str := strings.Builder{}
 		for _, s := range r.stack_message {
-			str.WriteString(s)
+			str.WriteString(p.Text(s))
 		}
 		return str.String()
 	}())
@@ -556,6 +609,32 @@ func process(resp Response, actions ...func(Response) ResponseErrorFunc) func()
 	}
 }
 
+// DecodeReject decodes the body of a rejected response into v, for every
+// status RejectResolver knows. The error of the status is still returned,
+// joined with the decode failure if any. Use it last in OnReject.
+func DecodeReject(v any) func(Response) RejectResolver {
+	return func(resp Response) RejectResolver {
+		return resp.on_reject.wrap(func(reject func() error) func() error {
+			return func() error {
+				return errors.Join(reject(), resp.decode(v))
+			}
+		})
+	}
+}
+
+// wrap replaces every set resolver of r with fn applied to it.
+func (r RejectResolver) wrap(fn func(func() error) func() error) RejectResolver {
+	v := reflect.ValueOf(&r).Elem()
+	for i := range v.NumField() {
+		reject, ok := v.Field(i).Interface().(func() error)
+		if ok && reject != nil {
+			v.Field(i).Set(reflect.ValueOf(fn(reject)))
+		}
+	}
+
+	return r
+}
+
 type DecodeBodyFunc func() error
 
 var (
@@ -564,8 +643,14 @@ var (
 	ErrResponseBodyNil      = errors.New("Received response body is empty")
 )
 
+// decode leaves v untouched on bodiless responses.
 func (resp Response) decode(v any) error {
-	switch resp.content_type {
+	if resp.Bodiless() {
+		return nil
+	}
+
+	media_type, _, _ := mime.ParseMediaType(resp.content_type)
+	switch media_type {
 	case "application/json":
 		if err := json.NewDecoder(resp.body).Decode(v); err != nil {
 			return err
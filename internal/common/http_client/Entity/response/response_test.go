@@ -126,4 +126,68 @@ func TestResponseOptions(t *testing.T) {
     Stack Message: 
     `), actual_err.Log())
 	})
+
+	t.Run("Log masks credentials", func(t *testing.T) {
+		newResp := response.ResponseStatusCode(500)(response.Response{})
+		newResp = response.OnReject(
+			response.OnInternalServerError(
+				response.SetClientError("Upstream failed"),
+				func(response.Response) response.ResponseErrorFunc {
+					return response.Stack("GET https://example.com/v1?api_key=k1")
+				},
+			),
+		)(newResp)
+
+		err := newResp.ResolveReject()
+		actual_err := err.(response.ResponseError)
+		assert.Contains(t, actual_err.Log(), "api_key=[REDACTED]")
+		assert.NotContains(t, actual_err.Log(), "k1")
+	})
+
+	t.Run("Decode reject body with default error", func(t *testing.T) {
+		var body struct {
+			Error string `json:"error"`
+		}
+		newResp := response.ResponseBody(
+			strings.NewReader(`{"error":"bad bad request"}`),
+		)(response.Response{})
+		newResp = response.ResponseContentType("application/json")(newResp)
+		newResp = response.ResponseStatusCode(400)(newResp)
+		newResp = response.OnReject(
+			response.DecodeReject(&body),
+		)(newResp)
+
+		err := newResp.ResolveReject()
+		assert.ErrorAs(t, err, &response.ResponseError{})
+		assert.ErrorContains(t, err, "Bad request")
+		assert.Equal(t, "bad bad request", body.Error)
+	})
+
+	t.Run("Bodiless response needs no success action", func(t *testing.T) {
+		newResp, err := response.NewResponse(
+			response.ResponseHeader(http.Header{"Content-Type": {"application/json"}}),
+			response.ResponseBody(http.NoBody),
+			response.ResponseContentType("application/json"),
+			response.ResponseStatusCode(200),
+			response.ResponseMethod(http.MethodHead),
+		)
+		assert.NoError(t, err)
+		assert.True(t, newResp.Bodiless())
+		assert.NoError(t, newResp.Resolve())
+	})
+
+	t.Run("Decode leaves the data of a bodiless response untouched", func(t *testing.T) {
+		data := struct {
+			Name string `json:"name"`
+		}{"kept"}
+		newResp := response.ResponseBody(http.NoBody)(response.Response{})
+		newResp = response.ResponseContentType("application/json")(newResp)
+		newResp = response.ResponseStatusCode(http.StatusNoContent)(newResp)
+		newResp = response.OnSuccess(
+			response.DecodeOrFail(&data),
+		)(newResp)
+
+		assert.NoError(t, newResp.ResolveSuccess())
+		assert.Equal(t, "kept", data.Name)
+	})
 }
@@ -0,0 +1,116 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+	ErrInvalidBudget        = errors.New("retry budget needs a ratio within [0, 1], a non negative floor and a positive window")
+)
+
+// budgetBuckets is the resolution of the sliding window.
+const budgetBuckets = 10
+
+// Budget caps retries to a share of the requests made over a sliding window,
+// so an outage does not multiply the load sent upstream. Share one Budget
+// between every client calling the same upstream.
+type Budget struct {
+	ratio       float64
+	min_retries int
+	bucket_size time.Duration
+	clock       func() time.Time
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+}
+
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+type BudgetConfig struct {
+	clock func() time.Time
+}
+
+type BudgetOptions func(BudgetConfig) BudgetConfig
+
+func BudgetClock(fn func() time.Time) BudgetOptions {
+	return func(c BudgetConfig) BudgetConfig {
+		c.clock = fn
+		return c
+	}
+}
+
+// NewBudget allows retries up to ratio of the requests seen within window,
+// and always at least min_retries per window.
+func NewBudget(ratio float64, min_retries int, window time.Duration, opts ...BudgetOptions) (*Budget, error) {
+	if ratio < 0 || ratio > 1 || min_retries < 0 || window/budgetBuckets <= 0 {
+		return nil, ErrInvalidBudget
+	}
+
+	cfg := BudgetConfig{clock: time.Now}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return &Budget{
+		ratio:       ratio,
+		min_retries: min_retries,
+		bucket_size: window / budgetBuckets,
+		clock:       cfg.clock,
+	}, nil
+}
+
+// current returns the bucket of now, recycling it when it belongs to an
+// earlier turn of the window.
+func (b *Budget) current(now time.Time) *budgetBucket {
+	start := now.Truncate(b.bucket_size)
+	bucket := &b.buckets[start.UnixNano()/int64(b.bucket_size)%budgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+
+	return bucket
+}
+
+func (b *Budget) sum(now time.Time) (requests, retries int) {
+	oldest := now.Truncate(b.bucket_size).Add(-b.bucket_size * (budgetBuckets - 1))
+	for _, bucket := range b.buckets {
+		if bucket.start.Before(oldest) {
+			continue
+		}
+		requests += bucket.requests
+		retries += bucket.retries
+	}
+
+	return requests, retries
+}
+
+// Request records a first attempt.
+func (b *Budget) Request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.current(b.clock()).requests++
+}
+
+// Withdraw takes a retry from the budget, reporting false once it is spent.
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock()
+	requests, retries := b.sum(now)
+	allowed := max(float64(b.min_retries), b.ratio*float64(requests))
+	if float64(retries+1) > allowed {
+		return false
+	}
+
+	b.current(now).retries++
+	return true
+}
@@ -1,18 +1,64 @@
 package retry
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
 var (
 	ErrExceedMaxRetry         = errors.New("exceed max retry")
 	ErrInvalidMissingValidate = errors.New("invalid/missing validate option")
+	ErrInvalidMissingNext     = errors.New("invalid/missing next option")
+	ErrInvalidMaxRetry        = errors.New("max retries has to be at least 1")
+	ErrInvalidInterval        = errors.New("retry interval can not be negative")
+	ErrConflictOption         = errors.New("next/validate options can not be mixed with max retries/interval/validate options")
 )
 
+// ExceedMaxRetryError is returned once every attempt was made without an
+// accepted status code. It matches ErrExceedMaxRetry with errors.Is and
+// unwraps to the error resolved from the last response.
+type ExceedMaxRetryError struct {
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+func (e ExceedMaxRetryError) Error() string {
+	s := fmt.Sprintf("%s: %d attempts, last status %d", ErrExceedMaxRetry, e.Attempts, e.StatusCode)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e ExceedMaxRetryError) Is(target error) bool {
+	return target == ErrExceedMaxRetry
+}
+
+func (e ExceedMaxRetryError) Unwrap() error {
+	return e.Err
+}
+
+// Retry drives the attempts of a single call. Next and ValidateCode are
+// either given directly, in which case they own their state, or generated by
+// New from MaxRetries, Interval and Validate with fresh state on every call.
 type Retry struct {
 	Next         func() bool
 	ValidateCode func(int)
+
+	max_retries *int
+	interval    *time.Duration
+	validate    func(int) bool
+
+	next  func(context.Context) (bool, error)
+	state *retryState
+}
+
+type retryState struct {
+	attempts int
+	accepted bool
 }
 
 type RetryOptions func(Retry) Retry
@@ -31,50 +77,166 @@ func ValidateOption(fn func(int)) RetryOptions {
 	}
 }
 
+// MaxRetries is the total number of attempts, the first one included.
+func MaxRetries(n int) RetryOptions {
+	return func(r Retry) Retry {
+		r.max_retries = &n
+		return r
+	}
+}
+
+// Interval is the pause between two attempts.
+func Interval(d time.Duration) RetryOptions {
+	return func(r Retry) Retry {
+		r.interval = &d
+		return r
+	}
+}
+
+// Validate reports whether a status code is accepted, which ends the retries.
+func Validate(fn func(int) bool) RetryOptions {
+	return func(r Retry) Retry {
+		r.validate = fn
+		return r
+	}
+}
+
 func New(opts ...RetryOptions) (Retry, error) {
 	r := Retry{}
 
 	for _, opt := range opts {
 		r = opt(r)
 	}
-  
-  // TODO: add validation on retry option
+
+	if err := checkOptions(r); err != nil {
+		return Retry{}, err
+	}
+
+	if r.Next == nil {
+		r = r.generate()
+	}
 
 	return r, nil
 }
 
-func Default() []RetryOptions {
-	return Simple(1, 0, func(code int) bool { return true })
+func checkOptions(r Retry) error {
+	declarative := r.max_retries != nil || r.interval != nil || r.validate != nil
+	custom := r.Next != nil || r.ValidateCode != nil
+
+	switch {
+	case declarative && custom:
+		return ErrConflictOption
+	case custom && r.Next == nil:
+		return ErrInvalidMissingNext
+	case custom && r.ValidateCode == nil:
+		return ErrInvalidMissingValidate
+	case custom:
+		return nil
+	case r.validate == nil:
+		return ErrInvalidMissingValidate
+	case r.max_retries == nil || *r.max_retries < 1:
+		return ErrInvalidMaxRetry
+	case r.interval != nil && *r.interval < 0:
+		return ErrInvalidInterval
+	}
+
+	return nil
 }
 
-func Simple(max_retries int, interval time.Duration, validate_opt func(int) bool) []RetryOptions {
-	s := struct {
-		interval    time.Duration
-		max_retries int
-		cur_retries int
-	}{
-		interval:    interval,
-		max_retries: max_retries,
-		cur_retries: 0,
+func (r Retry) generate() Retry {
+	s := &retryState{}
+	max_retries := *r.max_retries
+	var interval time.Duration
+	if r.interval != nil {
+		interval = *r.interval
 	}
 
-	return []RetryOptions{
-		NextOption(func() bool {
-			if s.cur_retries == s.max_retries {
-				return false
-			}
+	r.state = s
+	r.next = func(ctx context.Context) (bool, error) {
+		if s.accepted || s.attempts == max_retries {
+			return false, nil
+		}
 
-			if s.cur_retries > 0 {
-				time.Sleep(s.interval)
-			}
+		if s.attempts > 0 && interval > 0 {
+			timer := time.NewTimer(interval)
+			defer timer.Stop()
 
-			s.cur_retries++
-			return true
-		}),
-		ValidateOption(func(code int) {
-			if validate_opt(code) {
-				s.cur_retries = s.max_retries
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-timer.C:
 			}
-		}),
+		}
+
+		s.attempts++
+		return true, nil
+	}
+	r.Next = func() bool {
+		more, _ := r.next(context.Background())
+		return more
+	}
+	r.ValidateCode = func(code int) {
+		s.accepted = r.validate(code)
+	}
+
+	return r
+}
+
+// NextContext is Next giving up the interval once ctx is done, with ctx.Err().
+// A Next given with NextOption is called as is.
+func (r Retry) NextContext(ctx context.Context) (bool, error) {
+	if r.next == nil {
+		return r.Next(), nil
+	}
+
+	return r.next(ctx)
+}
+
+// Attempts is the number of attempts made so far. It is only tracked for
+// retries generated from MaxRetries.
+func (r Retry) Attempts() int {
+	if r.state == nil {
+		return 0
+	}
+
+	return r.state.attempts
+}
+
+// Exhausted reports whether every attempt was made and none was accepted.
+func (r Retry) Exhausted() bool {
+	if r.state == nil {
+		return false
+	}
+
+	return !r.state.accepted && r.state.attempts == *r.max_retries
+}
+
+// Policy is a validated set of options that is safe to share between calls
+// and goroutines. Each New returns a Retry with its own state.
+type Policy struct {
+	opts []RetryOptions
+}
+
+func NewPolicy(opts ...RetryOptions) (Policy, error) {
+	if _, err := New(opts...); err != nil {
+		return Policy{}, err
+	}
+
+	return Policy{opts: opts}, nil
+}
+
+func (p Policy) New() (Retry, error) {
+	return New(p.opts...)
+}
+
+func Default() []RetryOptions {
+	return Simple(1, 0, func(code int) bool { return true })
+}
+
+func Simple(max_retries int, interval time.Duration, validate_opt func(int) bool) []RetryOptions {
+	return []RetryOptions{
+		MaxRetries(max_retries),
+		Interval(interval),
+		Validate(validate_opt),
 	}
 }
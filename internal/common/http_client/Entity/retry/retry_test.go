@@ -1,7 +1,10 @@
 package retry_test
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
 	"github.com/stretchr/testify/assert"
@@ -22,4 +25,144 @@ func TestSimpleRetry(t *testing.T) {
 
     assert.Equal(t, counter, 2)
 	})
+
+	t.Run("Interval gives up once the context is done", func(t *testing.T) {
+		r, err := retry.New(retry.Simple(3, time.Hour, func(code int) bool { return false })...)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		more, err := r.NextContext(ctx)
+		assert.True(t, more)
+		assert.NoError(t, err)
+		r.ValidateCode(500)
+
+		start := time.Now()
+		more, err = r.NextContext(ctx)
+		assert.False(t, more)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 1, r.Attempts())
+	})
+}
+
+func TestRetryOptionsValidation(t *testing.T) {
+	t.Run("Missing options", func(t *testing.T) {
+		_, err := retry.New()
+		assert.ErrorIs(t, err, retry.ErrInvalidMissingValidate)
+
+		_, err = retry.New(retry.NextOption(func() bool { return false }))
+		assert.ErrorIs(t, err, retry.ErrInvalidMissingValidate)
+
+		_, err = retry.New(retry.ValidateOption(func(int) {}))
+		assert.ErrorIs(t, err, retry.ErrInvalidMissingNext)
+
+		_, err = retry.New(retry.Validate(func(int) bool { return true }))
+		assert.ErrorIs(t, err, retry.ErrInvalidMaxRetry)
+	})
+
+	t.Run("Negative count and interval", func(t *testing.T) {
+		_, err := retry.New(retry.Simple(-1, 0, func(int) bool { return true })...)
+		assert.ErrorIs(t, err, retry.ErrInvalidMaxRetry)
+
+		_, err = retry.New(retry.Simple(1, -time.Second, func(int) bool { return true })...)
+		assert.ErrorIs(t, err, retry.ErrInvalidInterval)
+	})
+
+	t.Run("Conflicting options", func(t *testing.T) {
+		opts := append(retry.Simple(2, 0, func(int) bool { return true }), retry.NextOption(func() bool { return false }))
+		_, err := retry.New(opts...)
+		assert.ErrorIs(t, err, retry.ErrConflictOption)
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("Every call starts with fresh state", func(t *testing.T) {
+		simple := retry.Simple(3, 0, func(code int) bool { return false })
+
+		for range 2 {
+			r, err := retry.New(simple...)
+			assert.NoError(t, err)
+
+			counter := 0
+			for r.Next() {
+				counter++
+				r.ValidateCode(500)
+			}
+
+			assert.Equal(t, 3, counter)
+			assert.Equal(t, 3, r.Attempts())
+			assert.True(t, r.Exhausted())
+		}
+	})
+
+	t.Run("Policy shared between goroutines", func(t *testing.T) {
+		p, err := retry.NewPolicy(retry.Simple(2, 0, func(code int) bool { return code == 200 })...)
+		assert.NoError(t, err)
+
+		wg := sync.WaitGroup{}
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r, err := p.New()
+				assert.NoError(t, err)
+				for r.Next() {
+					r.ValidateCode(200)
+				}
+				assert.Equal(t, 1, r.Attempts())
+				assert.False(t, r.Exhausted())
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		_, err := retry.NewPolicy(retry.MaxRetries(3))
+		assert.ErrorIs(t, err, retry.ErrInvalidMissingValidate)
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Run("Retries limited to a ratio of requests with a floor", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		b, err := retry.NewBudget(0.1, 2, 10*time.Second, retry.BudgetClock(func() time.Time { return now }))
+		assert.NoError(t, err)
+
+		// The floor allows retries before enough requests were seen.
+		assert.True(t, b.Withdraw())
+		assert.True(t, b.Withdraw())
+		assert.False(t, b.Withdraw())
+
+		for range 30 {
+			b.Request()
+		}
+		assert.True(t, b.Withdraw())
+		assert.False(t, b.Withdraw(), "10% of 30 requests")
+	})
+
+	t.Run("Spent budget recovers once the window slides", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		b, err := retry.NewBudget(0, 1, 10*time.Second, retry.BudgetClock(func() time.Time { return now }))
+		assert.NoError(t, err)
+
+		assert.True(t, b.Withdraw())
+		assert.False(t, b.Withdraw())
+
+		now = now.Add(9 * time.Second)
+		assert.False(t, b.Withdraw())
+
+		now = now.Add(time.Second)
+		assert.True(t, b.Withdraw())
+	})
+
+	t.Run("Invalid budget", func(t *testing.T) {
+		_, err := retry.NewBudget(1.5, 0, time.Second)
+		assert.ErrorIs(t, err, retry.ErrInvalidBudget)
+
+		_, err = retry.NewBudget(0.1, 0, 0)
+		assert.ErrorIs(t, err, retry.ErrInvalidBudget)
+	})
 }
@@ -1,20 +1,26 @@
 package async
 
-import "github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+import (
+	"sync"
 
-type ClientGenerator func() (client.Client, error)
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+type ClientGenerator func() (client.Result, error)
 
 func PrepareClientGenerator(
 	reqFunc client.ClientRequestFunc,
 	resFunc client.ClientResponseFunc,
 ) ClientGenerator {
-	return func() (client.Client, error) {
+	return func() (client.Result, error) {
 		return client.SendDefault(reqFunc, resFunc)
 	}
 }
 
+// ClientAsync is the outcome of one generator. Client.Request tells which
+// call it answers.
 type ClientAsync struct {
-	Client client.Client
+	Client client.Result
 	Err    error
 }
 
@@ -43,12 +49,29 @@ func Async(
 	return clientStream
 }
 
+// Do runs every generator concurrently. The channel yields the outcomes in
+// completion order and is closed once all of them are in, without the caller
+// having to drain it.
 func Do(clientFunc ...ClientGenerator) <-chan ClientAsync {
-  done := make(chan struct{})
-  defer close(done)
+	clientStream := make(chan ClientAsync, len(clientFunc))
+
+	var wg sync.WaitGroup
+	for _, send := range clientFunc {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := send()
+			clientStream <- ClientAsync{
+				Client: client,
+				Err:    err,
+			}
+		}()
+	}
 
-  async_client := Async(done, clientFunc...)
-  for client := range async_client {
+	go func() {
+		wg.Wait()
+		close(clientStream)
+	}()
 
-  }
+	return clientStream
 }
@@ -69,10 +69,10 @@ func TestAsyncDefaultClient(t *testing.T) {
 
 		got := map[string]any{
 			"/api/v1/save-message":         &returnData,
-			"/api/v1/additional_response":  &additional_response_data,
+			"/api/v1/additional-response":  &additional_response_data,
 			"/api/v1/recommended-response": &recommended_response_data,
 		}
-		result := async.Do(
+		async_client := async.Do(
 			async.PrepareClientGenerator(
 				client.PrepareRequest(
 					request.Get(),
@@ -121,7 +121,7 @@ func TestAsyncDefaultClient(t *testing.T) {
 
 		expect := map[string]any{
 			"/api/v1/save-message":         &Data{"Hello World Appended"},
-			"/api/v1/additional_response":  &AddtionalMsg{"additional msg"},
+			"/api/v1/additional-response":  &AddtionalMsg{"additional msg"},
 			"/api/v1/recommended-response": &RecommendedResponse{"recommended msg"},
 		}
 
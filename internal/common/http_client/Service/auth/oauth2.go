@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+var (
+	ErrTokenUrlInvalid    = errors.New("token url has to be an absolute url")
+	ErrTokenFetch         = errors.New("fail to fetch oauth2 token")
+	ErrMissingAccessToken = errors.New("token response has no access_token")
+)
+
+const (
+	grantClientCredentials = "client_credentials"
+	grantRefreshToken      = "refresh_token"
+)
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+
+	Expiry time.Time `json:"-"`
+}
+
+// Valid reports whether the token can still be used delta before it expires.
+// A token without expiry stays valid until it is invalidated.
+func (t Token) Valid(delta time.Duration) bool {
+	if t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+type Config struct {
+	scopes        []string
+	expiry_delta  time.Duration
+	fetch_timeout time.Duration
+	client        client.Client
+}
+
+type ConfigOptions func(Config) Config
+
+func Scopes(scopes ...string) ConfigOptions {
+	return func(c Config) Config {
+		c.scopes = append(c.scopes, scopes...)
+		return c
+	}
+}
+
+// ExpiryDelta refreshes tokens this long before they actually expire.
+func ExpiryDelta(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.expiry_delta = d
+		return c
+	}
+}
+
+// FetchTimeout bounds a token fetch, 30 seconds by default. The fetch is
+// shared by every caller waiting on it, so it does not end with any of their
+// contexts.
+func FetchTimeout(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.fetch_timeout = d
+		return c
+	}
+}
+
+// TokenClient sets the client used to call the token endpoint, e.g. one with
+// TLS or middlewares configured. Its events are replaced on every fetch.
+func TokenClient(c client.Client) ConfigOptions {
+	return func(cfg Config) Config {
+		cfg.client = c
+		return cfg
+	}
+}
+
+// OAuth2 is a client.Authenticator that caches a bearer token and refreshes
+// it once for all concurrent callers.
+type OAuth2 struct {
+	token_url     string
+	client_id     string
+	client_secret string
+	grant         string
+	config        Config
+
+	mu            sync.Mutex
+	token         Token
+	refresh_token string
+	inflight      *fetchCall
+}
+
+type fetchCall struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+func newOAuth2(token_url, client_id, client_secret, grant string, opts ...ConfigOptions) *OAuth2 {
+	cfg := Config{
+		expiry_delta:  10 * time.Second,
+		fetch_timeout: 30 * time.Second,
+		client:        client.New("OAuth2Token"),
+	}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return &OAuth2{
+		token_url:     token_url,
+		client_id:     client_id,
+		client_secret: client_secret,
+		grant:         grant,
+		config:        cfg,
+	}
+}
+
+func ClientCredentials(token_url, client_id, client_secret string, opts ...ConfigOptions) *OAuth2 {
+	return newOAuth2(token_url, client_id, client_secret, grantClientCredentials, opts...)
+}
+
+// RefreshToken exchanges refresh_token for access tokens. A refresh token
+// rotated by the server replaces the initial one.
+func RefreshToken(token_url, client_id, client_secret, refresh_token string, opts ...ConfigOptions) *OAuth2 {
+	o := newOAuth2(token_url, client_id, client_secret, grantRefreshToken, opts...)
+	o.refresh_token = refresh_token
+	return o
+}
+
+func (o *OAuth2) Authorize(ctx context.Context, req *http.Request) error {
+	tok, err := o.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", tok.authorization())
+	return nil
+}
+
+func (t Token) authorization() string {
+	token_type := t.TokenType
+	if token_type == "" || strings.EqualFold(token_type, "bearer") {
+		token_type = "Bearer"
+	}
+
+	return token_type + " " + t.AccessToken
+}
+
+// Invalidate drops the cached token if rejected was authorized with it, or
+// is unknown. A token fetched since then by another caller is kept.
+func (o *OAuth2) Invalidate(rejected *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if rejected != nil && rejected.Header.Get("Authorization") != o.token.authorization() {
+		return
+	}
+	o.token = Token{}
+}
+
+// Token returns the cached token or fetches a new one. Concurrent callers
+// share a single fetch, while each of them may give up on its own context.
+func (o *OAuth2) Token(ctx context.Context) (Token, error) {
+	o.mu.Lock()
+	if o.token.Valid(o.config.expiry_delta) {
+		tok := o.token
+		o.mu.Unlock()
+		return tok, nil
+	}
+
+	call := o.inflight
+	if call == nil {
+		call = &fetchCall{done: make(chan struct{})}
+		o.inflight = call
+		go o.refresh(ctx, call)
+	}
+	o.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+func (o *OAuth2) refresh(ctx context.Context, call *fetchCall) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.config.fetch_timeout)
+	defer cancel()
+
+	o.mu.Lock()
+	refresh_token := o.refresh_token
+	o.mu.Unlock()
+
+	call.token, call.err = o.fetch(ctx, refresh_token)
+
+	o.mu.Lock()
+	if call.err == nil {
+		o.token = call.token
+		if call.token.RefreshToken != "" {
+			o.refresh_token = call.token.RefreshToken
+		}
+	}
+	o.inflight = nil
+	o.mu.Unlock()
+
+	close(call.done)
+}
+
+type tokenForm struct {
+	GrantType    string `form:"grant_type"`
+	Scope        string `form:"scope,omitempty"`
+	RefreshToken string `form:"refresh_token,omitempty"`
+}
+
+func (o *OAuth2) fetch(ctx context.Context, refresh_token string) (Token, error) {
+	u, err := url.Parse(o.token_url)
+	if err != nil || !u.IsAbs() {
+		return Token{}, fmt.Errorf("%w:%s", ErrTokenUrlInvalid, o.token_url)
+	}
+
+	form := tokenForm{
+		GrantType: o.grant,
+		Scope:     strings.Join(o.config.scopes, " "),
+	}
+	if o.grant == grantRefreshToken {
+		form.RefreshToken = refresh_token
+	}
+
+	credentials := base64.StdEncoding.EncodeToString(
+		[]byte(url.QueryEscape(o.client_id) + ":" + url.QueryEscape(o.client_secret)),
+	)
+
+	var tok Token
+	err = o.config.client.
+		Register(
+			client.BeforeDoRequest(
+				request.Post(),
+				request.Domain(u.Scheme+"://"+u.Host),
+				request.Path(u.EscapedPath()),
+				request.Header(
+					request.SetRequestHeader("Authorization", "Basic "+credentials),
+					request.SetRequestHeader("Accept", "application/json"),
+				),
+				request.Form(form),
+			),
+			client.OnDoRequest(retry.Default()...),
+			client.AfterDoRequest(
+				response.OnSuccess(
+					response.DecodeOrFail(&tok),
+				),
+				response.OnReject(),
+			),
+		).SendContext(ctx)
+	if err != nil {
+		return Token{}, fmt.Errorf("%w:%w", ErrTokenFetch, err)
+	}
+
+	if tok.AccessToken == "" {
+		return Token{}, ErrMissingAccessToken
+	}
+	if tok.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+
+	return tok, nil
+}
@@ -0,0 +1,237 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/auth"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upstream issues "token-N" from /oauth/token and only accepts the latest
+// token on /api/v1/data.
+type upstream struct {
+	server  *httptest.Server
+	fetches atomic.Int32
+
+	mu      sync.Mutex
+	current string
+	forms   []string
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+
+	u := &upstream{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client-id" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+
+		// Slow enough for concurrent callers to pile up on one fetch.
+		time.Sleep(20 * time.Millisecond)
+		n := u.fetches.Add(1)
+
+		u.mu.Lock()
+		u.current = fmt.Sprintf("token-%d", n)
+		u.forms = append(u.forms, r.PostForm.Encode())
+		u.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    3600,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	})
+	mux.HandleFunc("GET /api/v1/data", func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		current := u.current
+		u.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer "+current {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	u.server = httptest.NewServer(mux)
+	t.Cleanup(u.server.Close)
+
+	return u
+}
+
+// revoke makes the upstream reject every token issued so far.
+func (u *upstream) revoke() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.current = "revoked"
+}
+
+func (u *upstream) send(a client.Authenticator) (string, error) {
+	var data string
+	err := client.New("Data").
+		Auth(a).
+		Register(
+			client.BeforeDoRequest(
+				request.Get(),
+				request.Domain(u.server.URL),
+				request.Path("/api/v1/data"),
+			),
+			client.OnDoRequest(retry.Default()...),
+			client.AfterDoRequest(
+				response.OnSuccess(
+					response.Decode(&data),
+				),
+				response.OnReject(),
+			),
+		).Send()
+
+	return data, err
+}
+
+func TestOAuth2(t *testing.T) {
+	t.Run("Client credentials token is cached between calls", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.ClientCredentials(u.server.URL+"/oauth/token", "client-id", "client-secret", auth.Scopes("read", "write"))
+
+		for range 3 {
+			data, err := u.send(a)
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", data)
+		}
+
+		assert.EqualValues(t, 1, u.fetches.Load())
+		assert.Equal(t, []string{"grant_type=client_credentials&scope=read+write"}, u.forms)
+	})
+
+	t.Run("Concurrent callers share one token fetch", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.ClientCredentials(u.server.URL+"/oauth/token", "client-id", "client-secret")
+
+		wg := sync.WaitGroup{}
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := u.send(a)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, u.fetches.Load())
+	})
+
+	t.Run("Unauthorized answer forces one refresh and retry", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.RefreshToken(u.server.URL+"/oauth/token", "client-id", "client-secret", "refresh-0")
+
+		_, err := u.send(a)
+		require.NoError(t, err)
+
+		u.revoke()
+		data, err := u.send(a)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", data)
+		assert.EqualValues(t, 2, u.fetches.Load())
+		assert.Equal(t, []string{
+			"grant_type=refresh_token&refresh_token=refresh-0",
+			"grant_type=refresh_token&refresh_token=refresh-1",
+		}, u.forms)
+	})
+
+	t.Run("Concurrent unauthorized answers refresh once", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.ClientCredentials(u.server.URL+"/oauth/token", "client-id", "client-secret")
+
+		_, err := u.send(a)
+		require.NoError(t, err)
+
+		u.revoke()
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := u.send(a)
+				assert.NoError(t, err)
+				assert.Equal(t, "ok", data)
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 2, u.fetches.Load())
+	})
+
+	t.Run("Hanging token endpoint times out", func(t *testing.T) {
+		hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The context only ends with the connection once the body is read.
+			r.ParseForm()
+			<-r.Context().Done()
+		}))
+		defer hang.Close()
+		a := auth.ClientCredentials(hang.URL+"/oauth/token", "client-id", "client-secret", auth.FetchTimeout(50*time.Millisecond))
+
+		start := time.Now()
+		_, err := a.Token(context.Background())
+
+		assert.ErrorIs(t, err, auth.ErrTokenFetch)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Malformed token response reports the decode error", func(t *testing.T) {
+		garbled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`<html>maintenance</html>`))
+		}))
+		defer garbled.Close()
+		a := auth.ClientCredentials(garbled.URL+"/oauth/token", "client-id", "client-secret")
+
+		_, err := a.Token(context.Background())
+
+		assert.ErrorIs(t, err, auth.ErrTokenFetch)
+		assert.ErrorAs(t, err, &response.ResponseError{})
+		assert.ErrorContains(t, err, "decode response body")
+		assert.NotErrorIs(t, err, auth.ErrMissingAccessToken)
+	})
+
+	t.Run("Token endpoint rejection surfaces as authorize error", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.ClientCredentials(u.server.URL+"/oauth/token", "client-id", "wrong-secret")
+
+		_, err := u.send(a)
+
+		assert.ErrorIs(t, err, client.ErrAuthorize)
+	})
+
+	t.Run("Waiter gives up on its own context", func(t *testing.T) {
+		u := newUpstream(t)
+		a := auth.ClientCredentials(u.server.URL+"/oauth/token", "client-id", "client-secret")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := a.Token(ctx)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,354 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen       = errors.New("circuit breaker is open")
+	ErrInvalidThreshold  = errors.New("breaker needs a consecutive failure or failure rate threshold")
+	ErrInvalidFailRate   = errors.New("breaker failure rate has to be within (0, 1]")
+	ErrInvalidCoolDown   = errors.New("breaker cool down has to be positive")
+	ErrInvalidHalfOpen   = errors.New("breaker half open probes has to be positive")
+	ErrInvalidRateWindow = errors.New("breaker failure rate needs a positive window and minimum requests")
+)
+
+// OpenError is returned while the breaker rejects calls. It matches
+// ErrCircuitOpen with errors.Is.
+type OpenError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e OpenError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", ErrCircuitOpen, e.Key, e.RetryAfter)
+}
+
+func (e OpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+type Config struct {
+	consecutive_failures int
+	failure_rate         float64
+	min_requests         int
+	window               time.Duration
+	cool_down            time.Duration
+	half_open_probes     int
+	is_failure           func(code int, err error) bool
+	clock                func() time.Time
+}
+
+type ConfigOptions func(Config) Config
+
+// ConsecutiveFailures opens the breaker after n failures in a row. Zero
+// disables the check.
+func ConsecutiveFailures(n int) ConfigOptions {
+	return func(c Config) Config {
+		c.consecutive_failures = n
+		return c
+	}
+}
+
+// FailureRate opens the breaker when at least min_requests were made within
+// window and the share of failures among them reaches rate.
+func FailureRate(rate float64, min_requests int, window time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.failure_rate = rate
+		c.min_requests = min_requests
+		c.window = window
+		return c
+	}
+}
+
+// CoolDown is how long the breaker stays open before letting probes through.
+func CoolDown(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.cool_down = d
+		return c
+	}
+}
+
+// HalfOpenProbes is the number of successful probes needed to close again.
+func HalfOpenProbes(n int) ConfigOptions {
+	return func(c Config) Config {
+		c.half_open_probes = n
+		return c
+	}
+}
+
+// FailureWhen decides which outcomes count as failures. By default transport
+// errors and 5xx answers do.
+func FailureWhen(fn func(code int, err error) bool) ConfigOptions {
+	return func(c Config) Config {
+		c.is_failure = fn
+		return c
+	}
+}
+
+func Clock(fn func() time.Time) ConfigOptions {
+	return func(c Config) Config {
+		c.clock = fn
+		return c
+	}
+}
+
+func defaultConfig() Config {
+	return Config{
+		consecutive_failures: 5,
+		cool_down:            30 * time.Second,
+		half_open_probes:     1,
+		is_failure: func(code int, err error) bool {
+			return err != nil || code >= http.StatusInternalServerError
+		},
+		clock: time.Now,
+	}
+}
+
+func newConfig(opts ...ConfigOptions) (Config, error) {
+	c := defaultConfig()
+	for _, opt := range opts {
+		c = opt(c)
+	}
+
+	switch {
+	case c.consecutive_failures <= 0 && c.failure_rate == 0:
+		return Config{}, ErrInvalidThreshold
+	case c.failure_rate < 0 || c.failure_rate > 1:
+		return Config{}, ErrInvalidFailRate
+	case c.failure_rate > 0 && (c.window <= 0 || c.min_requests <= 0):
+		return Config{}, ErrInvalidRateWindow
+	case c.cool_down <= 0:
+		return Config{}, ErrInvalidCoolDown
+	case c.half_open_probes <= 0:
+		return Config{}, ErrInvalidHalfOpen
+	}
+
+	return c, nil
+}
+
+type Breaker struct {
+	key    string
+	config Config
+
+	mu           sync.Mutex
+	state        State
+	generation   uint64
+	opened_at    time.Time
+	window_start time.Time
+	requests     int
+	failures     int
+	consecutive  int
+	probes       int
+	successes    int
+}
+
+func New(key string, opts ...ConfigOptions) (*Breaker, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Breaker{
+		key:          key,
+		config:       cfg,
+		window_start: cfg.clock(),
+	}, nil
+}
+
+func (b *Breaker) Key() string {
+	return b.key
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(b.config.clock())
+	return b.state
+}
+
+// Allow reports whether a call may go through. When it may, done has to be
+// called with the outcome of the call. An err matching context.Canceled or
+// context.DeadlineExceeded is the caller giving up rather than an outcome:
+// it is not recorded and frees the probe it took.
+func (b *Breaker) Allow() (done func(code int, err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.config.clock()
+	b.advance(now)
+
+	switch b.state {
+	case Open:
+		return nil, OpenError{b.key, b.opened_at.Add(b.config.cool_down).Sub(now)}
+	case HalfOpen:
+		if b.probes >= b.config.half_open_probes {
+			return nil, OpenError{b.key, 0}
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(code int, err error) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			b.release(generation)
+			return
+		}
+		b.record(generation, b.config.is_failure(code, err))
+	}, nil
+}
+
+func (b *Breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == HalfOpen {
+		b.probes--
+	}
+}
+
+// advance moves an open breaker to half-open after the cool down and starts a
+// new failure rate window when the previous one elapsed.
+func (b *Breaker) advance(now time.Time) {
+	if b.state == Open && !now.Before(b.opened_at.Add(b.config.cool_down)) {
+		b.transit(HalfOpen, now)
+	}
+
+	if b.config.failure_rate > 0 && now.Sub(b.window_start) >= b.config.window {
+		b.window_start = now
+		b.requests, b.failures = 0, 0
+	}
+}
+
+func (b *Breaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The outcome belongs to a state the breaker already left.
+	if generation != b.generation {
+		return
+	}
+
+	now := b.config.clock()
+	switch b.state {
+	case HalfOpen:
+		if failed {
+			b.transit(Open, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.half_open_probes {
+			b.transit(Closed, now)
+		}
+
+	case Closed:
+		b.requests++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+
+		if b.tripped() {
+			b.transit(Open, now)
+		}
+	}
+}
+
+func (b *Breaker) tripped() bool {
+	if b.config.consecutive_failures > 0 && b.consecutive >= b.config.consecutive_failures {
+		return true
+	}
+
+	return b.config.failure_rate > 0 &&
+		b.requests >= b.config.min_requests &&
+		float64(b.failures)/float64(b.requests) >= b.config.failure_rate
+}
+
+func (b *Breaker) transit(state State, now time.Time) {
+	b.state = state
+	b.generation++
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.successes = 0, 0
+	b.window_start = now
+	if state == Open {
+		b.opened_at = now
+	}
+}
+
+// KeyFunc picks the breaker of a call from the client name and the upstream
+// domain.
+type KeyFunc func(name, domain string) string
+
+func ByDomain(name, domain string) string {
+	return domain
+}
+
+func ByName(name, domain string) string {
+	return name
+}
+
+// Registry shares one breaker per upstream between every client using it.
+type Registry struct {
+	key  KeyFunc
+	opts []ConfigOptions
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewRegistry(key KeyFunc, opts ...ConfigOptions) (*Registry, error) {
+	if _, err := newConfig(opts...); err != nil {
+		return nil, err
+	}
+
+	return &Registry{
+		key:      key,
+		opts:     opts,
+		breakers: map[string]*Breaker{},
+	}, nil
+}
+
+func (r *Registry) Get(name, domain string) *Breaker {
+	key := r.key(name, domain)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[key]
+	if !ok {
+		// Options were validated by NewRegistry.
+		b, _ = New(key, r.opts...)
+		r.breakers[key] = b
+	}
+
+	return b
+}
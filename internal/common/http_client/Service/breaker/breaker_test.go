@@ -0,0 +1,239 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/breaker"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func call(t *testing.T, b *breaker.Breaker, code int) error {
+	t.Helper()
+
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	done(code, nil)
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("Consecutive failures open, cool down half opens, probe closes", func(t *testing.T) {
+		clock := &fakeClock{time.Unix(0, 0)}
+		b, err := breaker.New(
+			"payments",
+			breaker.ConsecutiveFailures(3),
+			breaker.CoolDown(10*time.Second),
+			breaker.Clock(clock.Now),
+		)
+		require.NoError(t, err)
+
+		for range 3 {
+			assert.NoError(t, call(t, b, http.StatusBadGateway))
+		}
+		assert.Equal(t, breaker.Open, b.State())
+
+		err = call(t, b, http.StatusOK)
+		assert.ErrorIs(t, err, breaker.ErrCircuitOpen)
+		var open breaker.OpenError
+		require.True(t, errors.As(err, &open))
+		assert.Equal(t, "payments", open.Key)
+		assert.Equal(t, 10*time.Second, open.RetryAfter)
+
+		clock.now = clock.now.Add(10 * time.Second)
+		assert.Equal(t, breaker.HalfOpen, b.State())
+
+		done, err := b.Allow()
+		require.NoError(t, err)
+		_, err = b.Allow()
+		assert.ErrorIs(t, err, breaker.ErrCircuitOpen, "only one probe at a time")
+
+		done(http.StatusOK, nil)
+		assert.Equal(t, breaker.Closed, b.State())
+	})
+
+	t.Run("Failed probe opens again", func(t *testing.T) {
+		clock := &fakeClock{time.Unix(0, 0)}
+		b, err := breaker.New("orders", breaker.ConsecutiveFailures(1), breaker.CoolDown(time.Second), breaker.Clock(clock.Now))
+		require.NoError(t, err)
+
+		assert.NoError(t, call(t, b, http.StatusInternalServerError))
+		clock.now = clock.now.Add(time.Second)
+		assert.NoError(t, call(t, b, http.StatusInternalServerError))
+
+		assert.Equal(t, breaker.Open, b.State())
+	})
+
+	t.Run("Success resets consecutive failures", func(t *testing.T) {
+		b, err := breaker.New("orders", breaker.ConsecutiveFailures(2))
+		require.NoError(t, err)
+
+		for range 5 {
+			assert.NoError(t, call(t, b, http.StatusInternalServerError))
+			assert.NoError(t, call(t, b, http.StatusOK))
+		}
+
+		assert.Equal(t, breaker.Closed, b.State())
+	})
+
+	t.Run("Failure rate within window", func(t *testing.T) {
+		clock := &fakeClock{time.Unix(0, 0)}
+		b, err := breaker.New(
+			"search",
+			breaker.ConsecutiveFailures(0),
+			breaker.FailureRate(0.5, 4, time.Minute),
+			breaker.Clock(clock.Now),
+		)
+		require.NoError(t, err)
+
+		assert.NoError(t, call(t, b, http.StatusOK))
+		assert.NoError(t, call(t, b, http.StatusServiceUnavailable))
+		assert.NoError(t, call(t, b, http.StatusOK))
+		assert.Equal(t, breaker.Closed, b.State(), "below minimum requests")
+
+		// A new window forgets the earlier outcomes.
+		clock.now = clock.now.Add(time.Minute)
+		assert.NoError(t, call(t, b, http.StatusOK))
+		assert.NoError(t, call(t, b, http.StatusOK))
+		assert.NoError(t, call(t, b, http.StatusServiceUnavailable))
+		assert.NoError(t, call(t, b, http.StatusServiceUnavailable))
+
+		assert.Equal(t, breaker.Open, b.State())
+	})
+
+	t.Run("Caller giving up is not an outcome", func(t *testing.T) {
+		clock := &fakeClock{time.Unix(0, 0)}
+		b, err := breaker.New("orders", breaker.ConsecutiveFailures(1), breaker.CoolDown(time.Second), breaker.Clock(clock.Now))
+		require.NoError(t, err)
+
+		done, err := b.Allow()
+		require.NoError(t, err)
+		done(0, fmt.Errorf("wrapped:%w", context.DeadlineExceeded))
+		assert.Equal(t, breaker.Closed, b.State())
+
+		assert.NoError(t, call(t, b, http.StatusInternalServerError))
+		clock.now = clock.now.Add(time.Second)
+		done, err = b.Allow()
+		require.NoError(t, err)
+		done(0, context.Canceled)
+
+		done, err = b.Allow()
+		require.NoError(t, err, "the abandoned probe is freed")
+		done(http.StatusOK, nil)
+		assert.Equal(t, breaker.Closed, b.State())
+	})
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := breaker.New("x", breaker.ConsecutiveFailures(0))
+		assert.ErrorIs(t, err, breaker.ErrInvalidThreshold)
+
+		_, err = breaker.New("x", breaker.FailureRate(1.5, 1, time.Second))
+		assert.ErrorIs(t, err, breaker.ErrInvalidFailRate)
+
+		_, err = breaker.NewRegistry(breaker.ByName, breaker.CoolDown(0))
+		assert.ErrorIs(t, err, breaker.ErrInvalidCoolDown)
+	})
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	t.Run("Open breaker fails fast without touching the network", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/quote", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		registry, err := breaker.NewRegistry(breaker.ByDomain, breaker.ConsecutiveFailures(2), breaker.CoolDown(time.Hour))
+		require.NoError(t, err)
+
+		send := func(name string) error {
+			return client.New(name).
+				CircuitBreaker(registry).
+				Register(
+					client.BeforeDoRequest(
+						request.Get(),
+						request.Domain(server.URL),
+						request.Path("/api/v1/quote"),
+					),
+					client.OnDoRequest(
+						retry.Simple(5, 0, func(code int) bool { return code == http.StatusOK })...,
+					),
+					client.AfterDoRequest(
+						response.OnSuccess(),
+						response.OnReject(),
+					),
+				).Send()
+		}
+
+		err = send("QuoteA")
+		assert.ErrorIs(t, err, breaker.ErrCircuitOpen)
+		assert.EqualValues(t, 2, hits.Load(), "retries stop once the breaker opens")
+
+		// Another client of the same domain shares the breaker.
+		err = send("QuoteB")
+		assert.ErrorIs(t, err, breaker.ErrCircuitOpen)
+		assert.EqualValues(t, 2, hits.Load())
+		assert.Equal(t, breaker.Open, registry.Get("QuoteB", server.URL).State())
+	})
+
+	t.Run("Cancelled calls leave the breaker closed", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/slow", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		registry, err := breaker.NewRegistry(breaker.ByDomain, breaker.ConsecutiveFailures(1), breaker.CoolDown(time.Hour))
+		require.NoError(t, err)
+
+		for range 3 {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			err := client.New("Slow").
+				CircuitBreaker(registry).
+				Register(
+					client.BeforeDoRequest(
+						request.Get(),
+						request.Domain(server.URL),
+						request.Path("/api/v1/slow"),
+					),
+					client.OnDoRequest(retry.Default()...),
+					client.AfterDoRequest(
+						response.OnSuccess(),
+						response.OnReject(),
+					),
+				).SendContext(ctx)
+			cancel()
+			assert.Error(t, err)
+		}
+
+		assert.Equal(t, breaker.Closed, registry.Get("Slow", server.URL).State())
+	})
+}
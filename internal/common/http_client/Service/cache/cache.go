@@ -0,0 +1,467 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+// StatusHeader is set on every response going through the cache.
+const StatusHeader = "X-Cache"
+
+const (
+	StatusMiss        = "MISS"
+	StatusHit         = "HIT"
+	StatusRevalidated = "REVALIDATED"
+	// StatusStale marks a response served past its freshness, either while a
+	// background refresh runs or because the upstream failed.
+	StatusStale = "STALE"
+)
+
+// IsStale reports whether the cache answered with a stale response.
+func IsStale(header http.Header) bool {
+	return header.Get(StatusHeader) == StatusStale
+}
+
+type Config struct {
+	credential_headers     []string
+	ttl                    time.Duration
+	default_ttl            time.Duration
+	stale_while_revalidate time.Duration
+	stale_if_error         time.Duration
+	clock                  func() time.Time
+}
+
+type ConfigOptions func(Config) Config
+
+// TTL overrides the freshness lifetime given by the upstream headers.
+// Responses marked no-store are still never stored, and those marked no-cache
+// or must-revalidate keep their own freshness.
+func TTL(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.ttl = d
+		return c
+	}
+}
+
+// DefaultTTL is the freshness lifetime of responses carrying neither
+// Cache-Control max-age nor Expires.
+func DefaultTTL(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.default_ttl = d
+		return c
+	}
+}
+
+// StaleWhileRevalidate serves expired responses for up to d past their
+// freshness while a single background request refreshes them. A
+// stale-while-revalidate directive from the upstream takes precedence.
+func StaleWhileRevalidate(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.stale_while_revalidate = d
+		return c
+	}
+}
+
+// StaleIfError serves expired responses for up to d past their freshness
+// when the upstream fails or answers 5xx. A stale-if-error directive from the
+// upstream takes precedence.
+func StaleIfError(d time.Duration) ConfigOptions {
+	return func(c Config) Config {
+		c.stale_if_error = d
+		return c
+	}
+}
+
+// CredentialHeaders adds headers identifying the caller, e.g. X-Api-Key, to
+// Authorization, Proxy-Authorization and Cookie. A stored response is only
+// served to requests with the same credentials.
+func CredentialHeaders(names ...string) ConfigOptions {
+	return func(c Config) Config {
+		c.credential_headers = append(c.credential_headers[:len(c.credential_headers):len(c.credential_headers)], names...)
+		return c
+	}
+}
+
+func Clock(fn func() time.Time) ConfigOptions {
+	return func(c Config) Config {
+		c.clock = fn
+		return c
+	}
+}
+
+// Cache is a private HTTP cache used as a client middleware.
+type Cache struct {
+	storage Storage
+	config  Config
+
+	// refreshing holds the keys of running background refreshes.
+	refreshing sync.Map
+}
+
+func New(storage Storage, opts ...ConfigOptions) *Cache {
+	cfg := Config{
+		credential_headers: []string{"Authorization", "Proxy-Authorization", "Cookie"},
+		clock:              time.Now,
+	}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return &Cache{storage: storage, config: cfg}
+}
+
+func key(method, url string) string {
+	return method + " " + url
+}
+
+// Invalidate drops the stored GET and HEAD responses of url.
+func (c *Cache) Invalidate(url string) {
+	c.storage.Delete(key(http.MethodGet, url))
+	c.storage.Delete(key(http.MethodHead, url))
+}
+
+func (c *Cache) Middleware() client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if info, ok := client.AttemptFromContext(req.Context()); ok && info.Stream {
+				return next.Do(req)
+			}
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return c.passThrough(next, req)
+			}
+
+			req_directives := directives(req.Header)
+			if _, ok := req_directives["no-store"]; ok {
+				return next.Do(req)
+			}
+
+			k := key(req.Method, req.URL.String())
+			now := c.config.clock()
+			entry, ok := c.storage.Get(k)
+			ok = ok && entry.matches(req) && entry.Credentials == c.credentials(req)
+
+			_, no_cache := req_directives["no-cache"]
+			if ok && !no_cache {
+				if now.Before(entry.Expires) {
+					return entry.response(req, StatusHit, now), nil
+				}
+
+				if c.stale(entry, "stale-while-revalidate", c.config.stale_while_revalidate, now) {
+					c.refresh(next, k, req, entry)
+					return entry.response(req, StatusStale, now), nil
+				}
+			}
+
+			resp, err := c.fetch(next, k, req, entry, ok, now)
+			if ok && failed(resp, err) && c.stale(entry, "stale-if-error", c.config.stale_if_error, now) {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return entry.response(req, StatusStale, now), nil
+			}
+
+			return resp, err
+		})
+	}
+}
+
+// fetch asks the upstream for a response, conditionally when an entry is
+// cached, and stores the outcome.
+func (c *Cache) fetch(next client.Doer, k string, req *http.Request, entry Entry, cached bool, now time.Time) (*http.Response, error) {
+	if cached {
+		req = conditional(req, entry)
+	}
+
+	resp, err := next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		entry = c.renew(entry, resp.Header, now)
+		c.storage.Set(k, entry)
+		return entry.response(req, StatusRevalidated, now), nil
+	}
+
+	return c.store(k, req, resp, now)
+}
+
+// refresh revalidates entry in the background, once per key at a time. The
+// caller may be gone by then, so its cancellation is not inherited.
+func (c *Cache) refresh(next client.Doer, k string, req *http.Request, entry Entry) {
+	if _, running := c.refreshing.LoadOrStore(k, struct{}{}); running {
+		return
+	}
+
+	req = req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer c.refreshing.Delete(k)
+
+		resp, err := c.fetch(next, k, req, entry, true, c.config.clock())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// stale reports whether entry may still be served within the window given by
+// directive, or by fallback when the upstream did not send it.
+func (c *Cache) stale(entry Entry, directive string, fallback time.Duration, now time.Time) bool {
+	d := directives(entry.Header)
+	if _, ok := d["must-revalidate"]; ok {
+		return false
+	}
+
+	window := fallback
+	if value, ok := d[directive]; ok {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			window = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return now.Before(entry.Expires.Add(window))
+}
+
+func failed(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// passThrough sends unsafe methods and invalidates what they may have
+// changed, as RFC 9111 section 4.4 asks.
+func (c *Cache) passThrough(next client.Doer, req *http.Request) (*http.Response, error) {
+	resp, err := next.Do(req)
+	if err == nil && resp.StatusCode < http.StatusBadRequest {
+		c.Invalidate(req.URL.String())
+	}
+
+	return resp, err
+}
+
+// conditional returns a copy of req asking the upstream to answer 304 when
+// entry is still current.
+func conditional(req *http.Request, entry Entry) *http.Request {
+	req = req.Clone(req.Context())
+	if etag := entry.ETag(); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := entry.LastModified(); modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+
+	return req
+}
+
+// store keeps resp when it may be served later. Only then is its body read,
+// other responses are passed through untouched.
+func (c *Cache) store(k string, req *http.Request, resp *http.Response, now time.Time) (*http.Response, error) {
+	entry, ok := c.entry(req, resp, now)
+	resp.Header.Set(StatusHeader, StatusMiss)
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry.Body = body
+	c.storage.Set(k, entry)
+	return resp, nil
+}
+
+// entry is the stored form of resp, without its body, if it is storable.
+func (c *Cache) entry(req *http.Request, resp *http.Response, now time.Time) (Entry, bool) {
+	lifetime, storable := c.lifetime(resp.Header, now)
+	if !storable || !cacheableStatus(resp.StatusCode) {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header.Clone(),
+		StoredAt:    now,
+		Expires:     now.Add(lifetime),
+		Credentials: c.credentials(req),
+	}
+	entry.Header.Del(StatusHeader)
+
+	servable := c.config.stale_while_revalidate > 0 || c.config.stale_if_error > 0
+	if lifetime <= 0 && entry.ETag() == "" && entry.LastModified() == "" && !servable {
+		return Entry{}, false
+	}
+
+	vary, ok := varyOn(req, resp.Header)
+	if !ok {
+		return Entry{}, false
+	}
+	entry.Vary = vary
+
+	return entry, true
+}
+
+// credentials fingerprints the credential headers of req, so that entries
+// do not hold them in clear. It is empty for anonymous requests.
+func (c *Cache) credentials(req *http.Request) string {
+	h := sha256.New()
+	found := false
+	for _, name := range c.config.credential_headers {
+		for _, value := range req.Header.Values(name) {
+			io.WriteString(h, http.CanonicalHeaderKey(name)+": "+value+"\n")
+			found = true
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// renew applies the headers of a 304 answer to entry.
+func (c *Cache) renew(entry Entry, header http.Header, now time.Time) Entry {
+	entry.Header = entry.Header.Clone()
+	for name, values := range header {
+		entry.Header[name] = values
+	}
+
+	lifetime, _ := c.lifetime(entry.Header, now)
+	entry.StoredAt = now
+	entry.Expires = now.Add(lifetime)
+	return entry
+}
+
+// lifetime returns how long a response stays fresh and whether it may be
+// stored at all.
+func (c *Cache) lifetime(header http.Header, now time.Time) (time.Duration, bool) {
+	d := directives(header)
+	if _, ok := d["no-store"]; ok {
+		return 0, false
+	}
+
+	if _, ok := d["no-cache"]; ok {
+		return 0, true
+	}
+
+	if _, ok := d["must-revalidate"]; !ok && c.config.ttl > 0 {
+		return c.config.ttl, true
+	}
+
+	age := time.Duration(0)
+	if seconds, err := strconv.Atoi(header.Get("Age")); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+
+	if max_age, ok := d["max-age"]; ok {
+		seconds, err := strconv.Atoi(max_age)
+		if err != nil {
+			return 0, true
+		}
+		return time.Duration(seconds)*time.Second - age, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, true
+		}
+
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return at.Sub(date) - age, true
+	}
+
+	return c.config.default_ttl, true
+}
+
+// directives parses Cache-Control into lower cased names and their values.
+func directives(header http.Header) map[string]string {
+	d := map[string]string{}
+	for _, line := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			d[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+
+	return d
+}
+
+// cacheableStatus lists the status codes RFC 9110 marks as heuristically
+// cacheable.
+func cacheableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusPartialContent, http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusPermanentRedirect, http.StatusNotFound, http.StatusMethodNotAllowed,
+		http.StatusGone, http.StatusRequestURITooLong, http.StatusNotImplemented:
+		return true
+	}
+
+	return false
+}
+
+// varyOn records the request headers named by Vary. A Vary of "*" can never
+// be matched, so such responses are not stored.
+func varyOn(req *http.Request, header http.Header) (http.Header, bool) {
+	vary := http.Header{}
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+
+	return vary, true
+}
+
+func (e Entry) matches(req *http.Request) bool {
+	for name, values := range e.Vary {
+		if strings.Join(values, ",") != strings.Join(req.Header.Values(name), ",") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e Entry) response(req *http.Request, status string, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set(StatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.StoredAt).Seconds())))
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,422 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/cache"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// status records the X-Cache header the cache middleware answered with.
+func status(into *string) client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if err == nil {
+				*into = resp.Header.Get(cache.StatusHeader)
+			}
+			return resp, err
+		})
+	}
+}
+
+func send(c *cache.Cache, method, url string, data *string, x_cache *string) error {
+	return client.New("Cache").
+		Use(status(x_cache), c.Middleware()).
+		Register(
+			client.BeforeDoRequest(
+				methodOption(method),
+				request.Domain(url),
+				request.Path("/api/v1/items"),
+			),
+			client.OnDoRequest(retry.Default()...),
+			client.AfterDoRequest(
+				response.OnSuccess(
+					response.Decode(data),
+				),
+				response.OnReject(),
+			),
+		).Send()
+}
+
+func methodOption(method string) request.RequestOptions {
+	if method == http.MethodPost {
+		return request.Post()
+	}
+	return request.Get()
+}
+
+func TestCache(t *testing.T) {
+	t.Run("Serve fresh responses from the cache", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		c := cache.New(cache.NewLRU(10), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusMiss, x_cache)
+
+		clock.Advance(30 * time.Second)
+		data = ""
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusHit, x_cache)
+		assert.Equal(t, "items", data)
+		assert.EqualValues(t, 1, hits.Load())
+
+		clock.Advance(time.Minute)
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusMiss, x_cache, "expired without validators")
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("Revalidate stale responses with ETag and Last-Modified", func(t *testing.T) {
+		modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+		var hits, not_modified atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "max-age=10")
+			if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == modified {
+				not_modified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", modified)
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		c := cache.New(cache.NewLRU(10), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+
+		clock.Advance(time.Minute)
+		data = ""
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusRevalidated, x_cache)
+		assert.Equal(t, "items", data)
+		assert.EqualValues(t, 1, not_modified.Load())
+
+		clock.Advance(5 * time.Second)
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusHit, x_cache, "304 renews the freshness")
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("Do not store no-store responses", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		c := cache.New(cache.NewLRU(10), cache.TTL(time.Hour))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("TTL overrides the upstream freshness", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "max-age=1")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		storage := cache.NewLRU(10)
+		long := cache.New(storage, cache.TTL(time.Hour), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(long, http.MethodGet, server.URL, &data, &x_cache))
+		clock.Advance(time.Minute)
+		require.NoError(t, send(long, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusHit, x_cache)
+		assert.EqualValues(t, 1, hits.Load())
+	})
+
+	t.Run("TTL does not skip the revalidation of no-cache responses", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		long := cache.New(cache.NewLRU(10), cache.TTL(time.Hour))
+
+		var data, x_cache string
+		require.NoError(t, send(long, http.MethodGet, server.URL, &data, &x_cache))
+		require.NoError(t, send(long, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusRevalidated, x_cache)
+		assert.Equal(t, "items", data)
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("Unsafe methods invalidate the stored response", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		c := cache.New(cache.NewLRU(10))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		require.NoError(t, send(c, http.MethodPost, server.URL, &data, &x_cache))
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusMiss, x_cache)
+		assert.EqualValues(t, 3, hits.Load())
+	})
+
+	t.Run("Stored responses are only served to the same credentials", func(t *testing.T) {
+		var hits atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(r.Header.Get("X-Api-Key")))
+		}))
+		defer server.Close()
+
+		c := cache.New(cache.NewLRU(10), cache.CredentialHeaders("X-Api-Key"))
+		get := func(api_key string) string {
+			var data string
+			err := client.New("Cache").
+				Use(c.Middleware()).
+				Register(
+					client.BeforeDoRequest(
+						request.Get(),
+						request.Domain(server.URL),
+						request.Path("/api/v1/items"),
+						request.Header(request.SetRequestHeader("X-Api-Key", api_key)),
+					),
+					client.OnDoRequest(retry.Default()...),
+					client.AfterDoRequest(
+						response.OnSuccess(
+							response.Decode(&data),
+						),
+						response.OnReject(),
+					),
+				).Send()
+			require.NoError(t, err)
+			return data
+		}
+
+		assert.Equal(t, "tenant-a", get("tenant-a"))
+		assert.Equal(t, "tenant-b", get("tenant-b"))
+		assert.Equal(t, "tenant-b", get("tenant-b"))
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("Responses that are not stored are not read", func(t *testing.T) {
+		body, writer := io.Pipe()
+		defer writer.Close()
+		next := client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Cache-Control": {"no-store"}},
+				Body:       body,
+				Request:    req,
+			}, nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/api/v1/events", nil)
+		resp, err := cache.New(cache.NewLRU(10)).Middleware()(next).Do(req)
+
+		require.NoError(t, err)
+		assert.Same(t, body, resp.Body)
+		assert.Equal(t, cache.StatusMiss, resp.Header.Get(cache.StatusHeader))
+	})
+
+	t.Run("Event streams bypass the cache whatever their headers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", client.EventStreamContentType)
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "data: hello\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		c := cache.New(cache.NewLRU(10))
+		var got []string
+		for ev, err := range client.Stream(ctx, client.New("Cache").Use(c.Middleware()), []request.RequestOptions{
+			request.Get(),
+			request.Domain(server.URL),
+			request.Path("/api/v1/events"),
+			request.Header(request.SetRequestHeader("Cache-Control", "max-age=60")),
+		}) {
+			require.NoError(t, err)
+			got = append(got, ev.Data)
+			break
+		}
+
+		assert.Equal(t, []string{"hello"}, got)
+		assert.NoError(t, ctx.Err())
+	})
+}
+
+func TestStale(t *testing.T) {
+	t.Run("Serve stale while refreshing in the background", func(t *testing.T) {
+		var hits atomic.Int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) > 1 {
+				<-release
+			}
+			w.Header().Set("Cache-Control", "max-age=10")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		c := cache.New(cache.NewLRU(10), cache.StaleWhileRevalidate(time.Minute), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+
+		clock.Advance(30 * time.Second)
+		for range 3 {
+			data = ""
+			require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+			assert.Equal(t, cache.StatusStale, x_cache)
+			assert.Equal(t, "items", data)
+		}
+
+		close(release)
+		assert.Eventually(t, func() bool {
+			send(c, http.MethodGet, server.URL, &data, &x_cache)
+			return x_cache == cache.StatusHit
+		}, time.Second, 10*time.Millisecond)
+		assert.EqualValues(t, 2, hits.Load(), "one refresh for every stale read")
+	})
+
+	t.Run("Serve stale when the upstream fails", func(t *testing.T) {
+		var failing atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Cache-Control", "max-age=10, stale-if-error=60")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		c := cache.New(cache.NewLRU(10), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+
+		failing.Store(true)
+		clock.Advance(30 * time.Second)
+		data = ""
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+		assert.Equal(t, cache.StatusStale, x_cache)
+		assert.Equal(t, "items", data)
+
+		clock.Advance(time.Minute)
+		assert.Error(t, send(c, http.MethodGet, server.URL, &data, &x_cache), "past the grace period")
+	})
+
+	t.Run("must-revalidate forbids stale responses", func(t *testing.T) {
+		var failing atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Cache-Control", "max-age=10, must-revalidate")
+			w.Write([]byte("items"))
+		}))
+		defer server.Close()
+
+		clock := &fakeClock{now: time.Now()}
+		c := cache.New(cache.NewLRU(10), cache.StaleIfError(time.Hour), cache.Clock(clock.Now))
+
+		var data, x_cache string
+		require.NoError(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+
+		failing.Store(true)
+		clock.Advance(time.Minute)
+		assert.Error(t, send(c, http.MethodGet, server.URL, &data, &x_cache))
+	})
+}
+
+func TestLRU(t *testing.T) {
+	t.Run("Evict the least recently used entry", func(t *testing.T) {
+		l := cache.NewLRU(2)
+		l.Set("a", cache.Entry{Body: []byte("a")})
+		l.Set("b", cache.Entry{Body: []byte("b")})
+
+		_, ok := l.Get("a")
+		require.True(t, ok)
+
+		l.Set("c", cache.Entry{Body: []byte("c")})
+		assert.Equal(t, 2, l.Len())
+
+		_, ok = l.Get("b")
+		assert.False(t, ok)
+		_, ok = l.Get("a")
+		assert.True(t, ok)
+		_, ok = l.Get("c")
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a stored response.
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	StoredAt time.Time
+	// Expires is when the entry stops being fresh.
+	Expires time.Time
+
+	// Vary holds the request header values the response varies on.
+	Vary http.Header
+	// Credentials fingerprints the credentials the response was fetched with,
+	// empty when there were none.
+	Credentials string
+}
+
+func (e Entry) ETag() string {
+	return e.Header.Get("ETag")
+}
+
+func (e Entry) LastModified() string {
+	return e.Header.Get("Last-Modified")
+}
+
+// Storage is the backend of a Cache. Implementations have to be safe for
+// concurrent use.
+type Storage interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry)
+	Delete(key string)
+}
+
+// LRU keeps up to capacity entries in memory, evicting the least recently
+// used one first.
+type LRU struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry Entry
+}
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (l *LRU) Get(key string) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.entries[key]
+	if !ok {
+		return Entry{}, false
+	}
+
+	l.order.MoveToFront(elem)
+	return elem.Value.(*lruItem).entry, true
+}
+
+func (l *LRU) Set(key string, entry Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.entries[key]; ok {
+		elem.Value.(*lruItem).entry = entry
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruItem{key, entry})
+	for l.capacity > 0 && l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruItem).key)
+	}
+}
+
+func (l *LRU) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.entries[key]; ok {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+	}
+}
+
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
@@ -0,0 +1,28 @@
+package client
+
+import "context"
+
+// AttemptInfo describes the attempt an outgoing request belongs to. Hedged
+// calls share the info of the attempt that started them, while coalesced
+// calls carry none.
+type AttemptInfo struct {
+	Client string
+	// Attempt counts from 1 within a single Send.
+	Attempt int
+	// Stream marks the connections of Stream, whose body is read as events
+	// arrive: middlewares must neither cache nor buffer it.
+	Stream bool
+}
+
+type attemptKey struct{}
+
+func withAttempt(ctx context.Context, info AttemptInfo) context.Context {
+	return context.WithValue(ctx, attemptKey{}, info)
+}
+
+// AttemptFromContext returns the attempt of a request sent by a Client, so
+// that middlewares can tell attempts apart.
+func AttemptFromContext(ctx context.Context) (AttemptInfo, bool) {
+	info, ok := ctx.Value(attemptKey{}).(AttemptInfo)
+	return info, ok
+}
@@ -1,13 +1,20 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/redact"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/breaker"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/ratelimit"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/tlsconfig"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/tracing"
 )
 
 type (
@@ -19,6 +26,33 @@ type (
 type Client struct {
 	Name  string
 	Event Event
+
+	middlewares []Middleware
+	transport   http.RoundTripper
+	auth        Authenticator
+	signer      Signer
+	breakers    *breaker.Registry
+	limiters    *ratelimit.Registry
+	hedge       *HedgePolicy
+	budget      *retry.Budget
+	tracer      *tracing.Tracer
+	hooks       *Hooks
+	timeout     time.Duration
+	reject      []func(response.Response) response.RejectResolver
+
+	retry_non_idempotent bool
+	idempotency_key      bool
+	no_coalesce          bool
+	streaming            bool
+}
+
+// Authenticator attaches credentials to every outgoing request.
+type Authenticator interface {
+	Authorize(ctx context.Context, req *http.Request) error
+	// Invalidate drops cached credentials so that the next Authorize obtains
+	// fresh ones. rejected is the request answered with a 401, nil when
+	// unknown: credentials that changed since it was authorized are kept.
+	Invalidate(rejected *http.Request)
 }
 
 type Event struct {
@@ -33,6 +67,80 @@ func New(name string) Client {
 	}
 }
 
+// TLS returns a copy of the client that talks to its upstream with cfg, e.g.
+// a client certificate or a private CA. Every connection picks up the
+// certificate files as they are on disk.
+func (c Client) TLS(cfg tlsconfig.Config) Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.TLSConfig()
+	transport.DialTLSContext = cfg.DialTLSContext
+	c.transport = transport
+	return c
+}
+
+// Auth returns a copy of the client that authorizes every request with a.
+// A 401 answer is retried once after a forced credential refresh.
+func (c Client) Auth(a Authenticator) Client {
+	c.auth = a
+	return c
+}
+
+// Signer signs the wire request of every attempt. It runs after the
+// Authenticator and the middleware chain, right before the transport, so the
+// headers added by middlewares are signed and retries are signed again with a
+// fresh timestamp.
+type Signer interface {
+	Sign(req request.Request, http_req *http.Request) error
+}
+
+func (c Client) Sign(s Signer) Client {
+	c.signer = s
+	return c
+}
+
+// CircuitBreaker returns a copy of the client whose attempts go through the
+// breaker of its upstream. An open breaker fails the attempt with
+// breaker.ErrCircuitOpen before anything is sent.
+func (c Client) CircuitBreaker(r *breaker.Registry) Client {
+	c.breakers = r
+	return c
+}
+
+// RateLimit returns a copy of the client whose attempts take a permit from
+// the limiter of its upstream first.
+func (c Client) RateLimit(r *ratelimit.Registry) Client {
+	c.limiters = r
+	return c
+}
+
+// Trace returns a copy of the client that records a span for every Send and
+// every attempt, and sends the trace context upstream.
+func (c Client) Trace(t *tracing.Tracer) Client {
+	c.tracer = t
+	return c
+}
+
+// RetryBudget returns a copy of the client whose retries are drawn from b.
+// Once b is spent, Send stops retrying with retry.ErrRetryBudgetExhausted.
+func (c Client) RetryBudget(b *retry.Budget) Client {
+	c.budget = b
+	return c
+}
+
+// Timeout returns a copy of the client bounding every Send, retries
+// included, to d.
+func (c Client) Timeout(d time.Duration) Client {
+	c.timeout = d
+	return c
+}
+
+// Reject returns a copy of the client whose Do and DoErr calls resolve
+// rejected responses with fns, see response.OnReject.
+func (c Client) Reject(fns ...func(response.Response) response.RejectResolver) Client {
+	c.reject = fns
+	return c
+}
+
 func (c Client) Register(
 	resolve_before BeforeClientRequest,
 	resolve_on_req OnClientRequest,
@@ -48,10 +156,94 @@ func (c Client) Register(
 var (
 	ErrNewRequest = errors.New("Initialize new request fail")
 	ErrRequestDo  = errors.New("On sending request fail")
+	ErrAuthorize  = errors.New("Authorize request fail")
+	ErrSign       = errors.New("Sign request fail")
+	ErrNoAttempt  = errors.New("Retry did not allow any attempt")
 )
 
-func do(req request.Request) (*http.Response, error) {
-	http_req, err := http.NewRequest(
+func (c Client) attempt(ctx context.Context, req request.Request) (*http.Response, error) {
+	if c.tracer == nil {
+		return c.shared(ctx, req)
+	}
+
+	info, _ := AttemptFromContext(ctx)
+	ctx, span := c.tracer.Start(ctx, fmt.Sprintf("%s attempt %d", c.Name, info.Attempt), tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("http.request.method", req.GetMethod())
+	span.SetAttribute("url.full", redact.Default().URL(req.GetUrl()))
+	span.SetAttribute("http.request.resend_count", info.Attempt-1)
+
+	http_resp, err := c.shared(ctx, req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	span.SetAttribute("http.response.status_code", http_resp.StatusCode)
+	if http_resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errors.New(http.StatusText(http_resp.StatusCode)))
+	}
+	return http_resp, nil
+}
+
+func (c Client) shared(ctx context.Context, req request.Request) (*http.Response, error) {
+	if !c.coalesces(req) {
+		return c.hedged(ctx, req)
+	}
+
+	return flights.do(ctx, c.flightKey(req), func(ctx context.Context) (*http.Response, error) {
+		return c.hedged(ctx, req)
+	})
+}
+
+// guarded makes one network call, hedged ones included, once the limiter and
+// the breaker of the upstream let it through.
+func (c Client) guarded(ctx context.Context, req request.Request) (*http.Response, error) {
+	if c.limiters != nil {
+		if err := c.limiters.Take(ctx, c.Name, req.GetDomain()); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.breakers == nil {
+		return c.do(ctx, req)
+	}
+
+	done, err := c.breakers.Get(c.Name, req.GetDomain()).Allow()
+	if err != nil {
+		return nil, err
+	}
+
+	http_resp, err := c.do(ctx, req)
+	if err != nil {
+		// A caller giving up says nothing about the upstream.
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w:%v", ctx.Err(), err)
+		}
+		done(0, err)
+		return nil, err
+	}
+
+	done(http_resp.StatusCode, nil)
+	return http_resp, nil
+}
+
+func (c Client) do(ctx context.Context, req request.Request) (*http.Response, error) {
+	http_resp, err := c.exchange(ctx, req)
+	if err != nil || c.auth == nil || http_resp.StatusCode != http.StatusUnauthorized {
+		return http_resp, err
+	}
+
+	// The credentials may have been revoked before they expired.
+	http_resp.Body.Close()
+	c.auth.Invalidate(http_resp.Request)
+	return c.exchange(ctx, req)
+}
+
+func (c Client) exchange(ctx context.Context, req request.Request) (*http.Response, error) {
+	http_req, err := http.NewRequestWithContext(
+		withClientTrace(ctx),
 		req.GetMethod(),
 		req.GetUrl(),
 		req.GetBodyReader(),
@@ -59,9 +251,19 @@ func do(req request.Request) (*http.Response, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%w:%v", ErrNewRequest, err)
 	}
+	http_req.Header = req.GetHeaders()
+	tracing.Inject(ctx, http_req.Header)
+
+	if c.auth != nil {
+		if err := c.auth.Authorize(ctx, http_req); err != nil {
+			return nil, fmt.Errorf("%w:%v", ErrAuthorize, err)
+		}
+	}
 
-	client := http.Client{}
-	http_resp, err := client.Do(http_req)
+	http_resp, err := c.doer(req).Do(http_req)
+	if errors.Is(err, ErrSign) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%w:%v", ErrRequestDo, err)
 	}
@@ -70,36 +272,128 @@ func do(req request.Request) (*http.Response, error) {
 }
 
 func (c Client) Send() error {
+	return c.SendContext(context.Background())
+}
+
+// SendContext is Send with a context that is carried by every attempt and
+// made available to the middleware chain.
+func (c Client) SendContext(ctx context.Context) error {
+	_, err := c.Execute(ctx)
+	return err
+}
+
+// Execute sends like SendContext and reports what happened. The Result is
+// filled as far as the call went, so it is worth reading on error too.
+func (c Client) Execute(ctx context.Context) (Result, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if c.tracer == nil {
+		return c.send(ctx)
+	}
+
+	ctx, span := c.tracer.Start(ctx, c.Name+" send", tracing.KindInternal)
+	defer span.End()
+	span.SetAttribute("client", c.Name)
+
+	result, err := c.send(ctx)
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetOk()
+	}
+	return result, err
+}
+
+func (c Client) send(ctx context.Context) (result Result, err error) {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
 	req, err := c.Event.OnResolveBefore()
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	retry, err := c.Event.OnClientRequest()
+	req = c.withIdempotencyKey(req)
+	result.Request = req
+
+	retrier, err := c.Event.OnClientRequest()
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	if c.budget != nil {
+		c.budget.Request()
 	}
 
-	var result *http.Response
-	for retry.Next() {
-		result, err = do(req)
+	var http_resp *http.Response
+	var last AttemptMeta
+	for {
+		more, wait_err := retrier.NextContext(ctx)
+		if wait_err != nil {
+			closeBody(http_resp)
+			last.Err = wait_err
+			c.hooks.onGiveUp(ctx, last)
+			return result, wait_err
+		}
+		if !more {
+			break
+		}
+
+		if http_resp != nil {
+			http_resp.Body.Close()
+
+			if c.budget != nil && !c.budget.Withdraw() {
+				last.Err = fmt.Errorf("%w:last status %d", retry.ErrRetryBudgetExhausted, http_resp.StatusCode)
+				c.hooks.onGiveUp(ctx, last)
+				return result, last.Err
+			}
+			c.hooks.onRetry(ctx, last)
+		}
+
+		http_resp, last, err = c.tracked(ctx, req, len(result.Attempts)+1)
+		result.Attempts = append(result.Attempts, last)
 		if err != nil {
-			return err
+			c.hooks.onGiveUp(ctx, last)
+			return result, err
 		}
 
-		retry.ValidateCode(result.StatusCode)
+		retrier.ValidateCode(http_resp.StatusCode)
+		if !c.canRetry(req) {
+			break
+		}
 	}
 
-	resp, err := c.Event.OnResolveAfter(result)
+	if http_resp == nil {
+		return result, ErrNoAttempt
+	}
+	defer http_resp.Body.Close()
+
+	resp, err := c.Event.OnResolveAfter(http_resp)
 	if err != nil {
-		return err
+		return result, err
 	}
+	result.Response = resp
 
-	if err := resp.Resolve(); err != nil {
-		return err
+	err = resp.Resolve()
+	if retrier.Exhausted() {
+		last.Err = err
+		// A lone attempt was never retried: its error stays as resolved.
+		if retrier.Attempts() > 1 {
+			last.Err = retry.ExceedMaxRetryError{
+				Attempts:   retrier.Attempts(),
+				StatusCode: http_resp.StatusCode,
+				Err:        err,
+			}
+		}
+		c.hooks.onGiveUp(ctx, last)
+		return result, last.Err
 	}
 
-	return nil
+	return result, err
 }
 
 func BeforeDoRequest(reqFunc ...request.RequestOptions) BeforeClientRequest {
@@ -116,6 +410,12 @@ func OnDoRequest(retryFunc ...retry.RetryOptions) OnClientRequest {
 	}
 }
 
+// OnRetryPolicy is OnDoRequest for a policy validated up front, which can be
+// shared by every client.
+func OnRetryPolicy(p retry.Policy) OnClientRequest {
+	return p.New
+}
+
 func AfterDoRequest(respFunc ...response.ResponseFunc) AfterClientRequest {
 	return func(resp *http.Response) (response.Response, error) {
 		resp_opts := []response.ResponseFunc{
@@ -124,6 +424,9 @@ func AfterDoRequest(respFunc ...response.ResponseFunc) AfterClientRequest {
 			response.ResponseContentType(resp.Header.Get("Content-Type")),
 			response.ResponseStatusCode(resp.StatusCode),
 		}
+		if resp.Request != nil {
+			resp_opts = append(resp_opts, response.ResponseMethod(resp.Request.Method))
+		}
 		for _, fn := range respFunc {
 			resp_opts = append(resp_opts, fn)
 		}
@@ -132,3 +435,30 @@ func AfterDoRequest(respFunc ...response.ResponseFunc) AfterClientRequest {
 		)
 	}
 }
+
+type (
+	ClientRequestFunc  = BeforeClientRequest
+	ClientResponseFunc = AfterClientRequest
+)
+
+// PrepareRequest is BeforeDoRequest under the name used with SendDefault.
+func PrepareRequest(reqFunc ...request.RequestOptions) ClientRequestFunc {
+	return BeforeDoRequest(reqFunc...)
+}
+
+// PrepareResponse is AfterDoRequest with the default reject errors, which
+// respFunc may replace with its own OnReject.
+func PrepareResponse(respFunc ...response.ResponseFunc) ClientResponseFunc {
+	return AfterDoRequest(append([]response.ResponseFunc{response.OnReject()}, respFunc...)...)
+}
+
+// DefaultClientName names the clients of SendDefault in logs and metrics.
+const DefaultClientName = "default"
+
+// SendDefault sends one request with the default retry policy and no
+// middleware.
+func SendDefault(reqFunc ClientRequestFunc, resFunc ClientResponseFunc) (Result, error) {
+	return New(DefaultClientName).
+		Register(reqFunc, OnDoRequest(retry.Default()...), resFunc).
+		Execute(context.Background())
+}
@@ -1,16 +1,29 @@
 package client_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
 	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/ratelimit"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/tracing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRequestAndResponseOptions(t *testing.T) {
@@ -64,3 +77,1321 @@ func TestRequestAndResponseOptions(t *testing.T) {
 		assert.EqualValues(t, Data{"Hello World Appended"}, returnData)
 	})
 }
+
+func TestMiddlewareChain(t *testing.T) {
+	t.Run("Global middlewares wrap client middlewares in order", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/trace", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Join(r.Header.Values("X-Trace"), ",")))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		var order []string
+		mark := func(name string) client.Middleware {
+			return func(next client.Doer) client.Doer {
+				return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+					order = append(order, name)
+					req.Header.Add("X-Trace", name)
+					return next.Do(req)
+				})
+			}
+		}
+
+		client.Use(mark("global"))
+		defer client.ResetMiddlewares()
+
+		var returnData string
+		err := client.New("Trace").
+			Use(mark("first"), mark("second")).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/trace"),
+				),
+				client.OnDoRequest(retry.Default()...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&returnData),
+					),
+					response.OnReject(),
+				),
+			).Send()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"global", "first", "second"}, order)
+		assert.Equal(t, "global,first,second", returnData)
+	})
+}
+
+func TestHedge(t *testing.T) {
+	var hits atomic.Int32
+	cancelled := make(chan struct{}, 1)
+	slow_first := func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		w.Write([]byte("fast"))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/slow", slow_first)
+	mux.HandleFunc("POST /api/v1/slow", slow_first)
+	mux.HandleFunc("GET /api/v1/steady", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("steady"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Hedge answers first and the slow call is cancelled", func(t *testing.T) {
+		hits.Store(0)
+		hedge, err := client.NewHedge(client.HedgeDelay(20 * time.Millisecond))
+		require.NoError(t, err)
+
+		start := time.Now()
+		data, _, err := client.Do[string](context.Background(), client.New("Slow").Hedge(hedge),
+			request.Get(), request.Domain(server.URL), request.Path("/api/v1/slow"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "fast", data)
+		assert.Less(t, time.Since(start), 400*time.Millisecond)
+		assert.EqualValues(t, 2, hits.Load())
+		assert.Equal(t, client.HedgeStats{Requests: 1, Hedges: 1, Wins: 1}, hedge.Stats())
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("slow call was not cancelled")
+		}
+	})
+
+	t.Run("Non idempotent methods are never hedged", func(t *testing.T) {
+		hits.Store(0)
+		hedge, err := client.NewHedge(client.HedgeDelay(20 * time.Millisecond))
+		require.NoError(t, err)
+
+		_, _, err = client.Do[string](context.Background(), client.New("Slow").Hedge(hedge),
+			request.Post(), request.Domain(server.URL), request.Path("/api/v1/slow"))
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, hits.Load())
+		assert.Equal(t, client.HedgeStats{}, hedge.Stats())
+	})
+
+	t.Run("Each hedged call takes its own permit", func(t *testing.T) {
+		hits.Store(0)
+		hedge, err := client.NewHedge(client.HedgeAttempts(3), client.HedgeDelay(10*time.Millisecond))
+		require.NoError(t, err)
+		limiters := ratelimit.NewRegistry(ratelimit.ByDomain, ratelimit.Reject, func() ratelimit.Limiter {
+			l, _ := ratelimit.NewTokenBucket(1, time.Hour, 2)
+			return l
+		})
+
+		data, _, err := client.Do[string](context.Background(), client.New("Steady").Hedge(hedge).RateLimit(limiters),
+			request.Get(), request.Domain(server.URL), request.Path("/api/v1/steady"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "steady", data)
+		assert.EqualValues(t, 2, hits.Load())
+		assert.Equal(t, ratelimit.Stats{Allowed: 2, Rejected: 1}, limiters.Stats()[server.URL])
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		_, err := client.NewHedge(client.HedgeAttempts(1), client.HedgeDelay(time.Millisecond))
+		assert.ErrorIs(t, err, client.ErrInvalidHedgeAttempts)
+
+		_, err = client.NewHedge()
+		assert.ErrorIs(t, err, client.ErrInvalidHedgeDelay)
+
+		_, err = client.NewHedge(client.HedgeDelay(time.Millisecond), client.HedgePercentile(100, 10))
+		assert.ErrorIs(t, err, client.ErrInvalidHedgePercentile)
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Run("Clients sharing a spent budget stop retrying", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/down", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		budget, err := retry.NewBudget(0, 1, time.Minute)
+		assert.NoError(t, err)
+
+		send := func(name string) error {
+			var data string
+			return client.New(name).
+				RetryBudget(budget).
+				Register(
+					client.BeforeDoRequest(
+						request.Get(),
+						request.Domain(server.URL),
+						request.Path("/api/v1/down"),
+					),
+					client.OnDoRequest(
+						retry.Simple(5, 0, func(code int) bool { return code == http.StatusOK })...,
+					),
+					client.AfterDoRequest(
+						response.OnSuccess(
+							response.Decode(&data),
+						),
+						response.OnReject(),
+					),
+				).Send()
+		}
+
+		err = send("DownA")
+		assert.ErrorIs(t, err, retry.ErrRetryBudgetExhausted)
+		assert.EqualValues(t, 2, hits.Load())
+
+		err = send("DownB")
+		assert.ErrorIs(t, err, retry.ErrRetryBudgetExhausted)
+		assert.EqualValues(t, 3, hits.Load())
+	})
+}
+
+func TestIdempotency(t *testing.T) {
+	var keys []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/orders", func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	three_attempts := client.DefaultRetry(retry.Simple(3, 0, func(code int) bool { return code == http.StatusOK })...)
+
+	t.Run("Non idempotent methods are sent once by default", func(t *testing.T) {
+		keys = nil
+		orders, err := client.NewTemplate(client.New("Orders"), client.BaseURL(server.URL), three_attempts)
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			endpoint client.Endpoint
+			sent     int
+		}{
+			{orders.Post("/api/v1/orders"), 1},
+			{orders.Patch("/api/v1/orders"), 2},
+			{orders.Put("/api/v1/orders"), 5},
+		} {
+			_, _, err := client.Call[string](context.Background(), tc.endpoint)
+			assert.Error(t, err)
+			assert.Len(t, keys, tc.sent)
+		}
+	})
+
+	t.Run("Opted in retries reuse one idempotency key per send", func(t *testing.T) {
+		keys = nil
+		orders, err := client.NewTemplate(
+			client.New("Orders").RetryNonIdempotent().IdempotencyKey(),
+			client.BaseURL(server.URL),
+			three_attempts,
+		)
+		require.NoError(t, err)
+
+		for range 2 {
+			_, _, err := client.Call[string](context.Background(), orders.Post("/api/v1/orders"))
+			assert.Error(t, err)
+		}
+
+		assert.Len(t, keys, 6)
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, keys[0])
+		assert.Equal(t, []string{keys[0], keys[0], keys[0]}, keys[:3])
+		assert.Equal(t, []string{keys[3], keys[3], keys[3]}, keys[3:])
+		assert.NotEqual(t, keys[0], keys[3])
+	})
+}
+
+func TestRetryExhaustion(t *testing.T) {
+	t.Run("Exceeded retries report the last attempt and keep the reject error", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/flaky", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		policy, err := retry.NewPolicy(
+			retry.Simple(3, 0, func(code int) bool { return code == http.StatusOK })...,
+		)
+		assert.NoError(t, err)
+
+		c := client.New("Flaky")
+		for range 2 {
+			var data string
+			err := c.Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/flaky"),
+				),
+				client.OnRetryPolicy(policy),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+
+			assert.ErrorIs(t, err, retry.ErrExceedMaxRetry)
+			assert.ErrorAs(t, err, &response.ResponseError{})
+
+			var exceeded retry.ExceedMaxRetryError
+			assert.ErrorAs(t, err, &exceeded)
+			assert.Equal(t, 3, exceeded.Attempts)
+			assert.Equal(t, http.StatusBadGateway, exceeded.StatusCode)
+		}
+
+		assert.EqualValues(t, 6, hits.Load(), "the policy is reused with fresh state")
+	})
+
+	t.Run("A single attempt keeps the resolved error", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/missing", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		var data string
+		err := client.New("Missing").
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/missing"),
+				),
+				client.OnDoRequest(
+					retry.Simple(1, 0, func(code int) bool { return code == http.StatusOK })...,
+				),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, retry.ErrExceedMaxRetry)
+		var resolved response.ResponseError
+		require.ErrorAs(t, err, &resolved)
+		assert.Equal(t, resolved.Error(), err.Error())
+	})
+
+	t.Run("Timeout cuts the interval between retries", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/flaky", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		start := time.Now()
+		err := client.New("Flaky").
+			Timeout(50*time.Millisecond).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/flaky"),
+				),
+				client.OnDoRequest(
+					retry.Simple(3, time.Hour, func(code int) bool { return code == http.StatusOK })...,
+				),
+				client.AfterDoRequest(
+					response.OnSuccess(),
+					response.OnReject(),
+				),
+			).Send()
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.EqualValues(t, 1, hits.Load())
+	})
+}
+
+func TestCoalesce(t *testing.T) {
+	var hits atomic.Int32
+	var release chan struct{}
+	large := strings.Repeat("x", 2<<20)
+	held := func(body func(r *http.Request) string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			<-release
+			w.Write([]byte(body(r)))
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/shared", held(func(r *http.Request) string { return "shared" }))
+	mux.HandleFunc("GET /api/v1/tenant", held(func(r *http.Request) string { return r.Header.Get("Authorization") }))
+	mux.HandleFunc("GET /api/v1/large", held(func(r *http.Request) string { return large }))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Identical calls share one upstream request", func(t *testing.T) {
+		hits.Store(0)
+		release = make(chan struct{})
+
+		var wg sync.WaitGroup
+		results := make([]string, 5)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, _, err := client.Do[string](context.Background(), client.New("Shared"),
+					request.Get(), request.Domain(server.URL), request.Path("/api/v1/shared"))
+				assert.NoError(t, err)
+				results[i] = data
+			}()
+		}
+
+		assert.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.EqualValues(t, 1, hits.Load())
+		assert.Equal(t, []string{"shared", "shared", "shared", "shared", "shared"}, results)
+	})
+
+	t.Run("A cancelled waiter does not cancel the others", func(t *testing.T) {
+		hits.Store(0)
+		release = make(chan struct{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelled := make(chan error, 1)
+		go func() {
+			_, _, err := client.Do[string](ctx, client.New("Shared"),
+				request.Get(), request.Domain(server.URL), request.Path("/api/v1/shared"))
+			cancelled <- err
+		}()
+		assert.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond)
+
+		waiting := make(chan string, 1)
+		go func() {
+			data, _, err := client.Do[string](context.Background(), client.New("Shared"),
+				request.Get(), request.Domain(server.URL), request.Path("/api/v1/shared"))
+			assert.NoError(t, err)
+			waiting <- data
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-cancelled, context.Canceled)
+
+		close(release)
+		assert.Equal(t, "shared", <-waiting)
+		assert.EqualValues(t, 1, hits.Load())
+	})
+
+	t.Run("Opted out clients always reach the upstream", func(t *testing.T) {
+		hits.Store(0)
+		release = make(chan struct{})
+
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := client.Do[string](context.Background(), client.New("Shared").NoCoalesce(),
+					request.Get(), request.Domain(server.URL), request.Path("/api/v1/shared"))
+				assert.NoError(t, err)
+			}()
+		}
+
+		assert.Eventually(t, func() bool { return hits.Load() == 3 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("Clients adding their own credentials never share", func(t *testing.T) {
+		hits.Store(0)
+		release = make(chan struct{})
+
+		authorize := func(token string) client.Middleware {
+			return func(next client.Doer) client.Doer {
+				return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+					req.Header.Set("Authorization", token)
+					return next.Do(req)
+				})
+			}
+		}
+
+		var wg sync.WaitGroup
+		results := make([]string, 2)
+		for i, token := range []string{"tenant-a", "tenant-b"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, _, err := client.Do[string](context.Background(), client.New("Shared").Use(authorize(token)),
+					request.Get(), request.Domain(server.URL), request.Path("/api/v1/tenant"))
+				assert.NoError(t, err)
+				results[i] = data
+			}()
+		}
+
+		assert.Eventually(t, func() bool { return hits.Load() == 2 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, []string{"tenant-a", "tenant-b"}, results)
+	})
+
+	t.Run("Bodies too large to share are fetched by every waiter", func(t *testing.T) {
+		hits.Store(0)
+		release = make(chan struct{})
+
+		var wg sync.WaitGroup
+		results := make([]string, 3)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, _, err := client.Do[string](context.Background(), client.New("Shared"),
+					request.Get(), request.Domain(server.URL), request.Path("/api/v1/large"))
+				assert.NoError(t, err)
+				results[i] = data
+			}()
+		}
+
+		assert.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.EqualValues(t, 4, hits.Load())
+		for _, data := range results {
+			assert.Len(t, data, len(large))
+		}
+	})
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("Send and attempt spans with traceparent sent upstream", func(t *testing.T) {
+		var hits atomic.Int32
+		var traceparents []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/traced", func(w http.ResponseWriter, r *http.Request) {
+			traceparents = append(traceparents, r.Header.Get("Traceparent"))
+			if hits.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("traced"))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		memory := tracing.NewMemory()
+		tracer := tracing.NewTracer("aggregator", memory)
+		ctx, root := tracer.Start(context.Background(), "inbound", tracing.KindServer)
+
+		var data string
+		err := client.New("Traced").
+			Trace(tracer).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/traced"),
+				),
+				client.OnDoRequest(retry.Simple(2, 0, func(code int) bool { return code == http.StatusOK })...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).SendContext(ctx)
+		assert.NoError(t, err)
+
+		spans := memory.Spans()
+		if !assert.Len(t, spans, 3) {
+			return
+		}
+		first, second, send := spans[0], spans[1], spans[2]
+
+		assert.Equal(t, "Traced send", send.Name)
+		assert.Equal(t, root.Context().SpanID, send.Parent)
+		assert.Equal(t, tracing.StatusOk, send.Status)
+
+		for i, attempt := range []tracing.SpanData{first, second} {
+			assert.Equal(t, root.Context().TraceID, attempt.Context.TraceID)
+			assert.Equal(t, send.Context.SpanID, attempt.Parent)
+			assert.Equal(t, tracing.KindClient, attempt.Kind)
+			assert.Equal(t, attempt.Context.Traceparent(), traceparents[i])
+		}
+		assert.Equal(t, "Traced attempt 1", first.Name)
+		assert.Equal(t, tracing.StatusError, first.Status)
+		assert.Equal(t, http.StatusBadGateway, first.Attributes["http.response.status_code"])
+		assert.Equal(t, 1, second.Attributes["http.request.resend_count"])
+	})
+
+	t.Run("Credentials in the URL are masked", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("traced"))
+		}))
+		defer server.Close()
+
+		memory := tracing.NewMemory()
+		var data string
+		err := client.New("Traced").
+			Trace(tracing.NewTracer("aggregator", memory)).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/traced"),
+					request.Query("api_key", "k1"),
+				),
+				client.OnDoRequest(retry.Simple(1, 0, func(code int) bool { return code == http.StatusOK })...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+		require.NoError(t, err)
+
+		spans := memory.Spans()
+		require.Len(t, spans, 2)
+		assert.Equal(t, server.URL+"/api/v1/traced?api_key=%5BREDACTED%5D", spans[0].Attributes["url.full"])
+	})
+}
+
+func TestHooks(t *testing.T) {
+	var hits, fail atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/hooked", func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("hooked"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var events []string
+	var metas []client.AttemptMeta
+	record := func(event string) func(context.Context, client.AttemptMeta) {
+		return func(_ context.Context, meta client.AttemptMeta) {
+			events = append(events, fmt.Sprintf("%s %d", event, meta.Attempt))
+			metas = append(metas, meta)
+		}
+	}
+
+	hooked, err := client.NewTemplate(
+		client.New("Hooked").Hooks(client.Hooks{
+			BeforeAttempt: record("before"),
+			AfterAttempt:  record("after"),
+			OnRetry:       record("retry"),
+			OnGiveUp:      record("give up"),
+		}),
+		client.BaseURL(server.URL),
+		client.DefaultRetry(retry.Simple(2, 0, func(code int) bool { return code == http.StatusOK })...),
+	)
+	require.NoError(t, err)
+
+	t.Run("Hooks fire around every attempt with timings", func(t *testing.T) {
+		hits.Store(0)
+		fail.Store(1)
+		events, metas = nil, nil
+
+		_, _, err := client.Call[string](context.Background(), hooked.Get("/api/v1/hooked"))
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"before 1", "after 1", "retry 1", "before 2", "after 2"}, events)
+
+		first, second := metas[1], metas[4]
+		assert.Equal(t, http.StatusBadGateway, first.StatusCode)
+		assert.Equal(t, "GET", first.Method)
+		assert.Equal(t, server.URL+"/api/v1/hooked", first.Url)
+		assert.False(t, first.Timings.Reused)
+		assert.Greater(t, first.Timings.Connect, time.Duration(0))
+		assert.Greater(t, first.Timings.TimeToFirstByte, time.Duration(0))
+		assert.GreaterOrEqual(t, first.Timings.Total, first.Timings.TimeToFirstByte)
+
+		assert.Equal(t, http.StatusOK, second.StatusCode)
+		assert.True(t, second.Timings.Reused)
+		assert.Zero(t, second.Timings.Connect)
+	})
+
+	t.Run("Give up once the retries are exhausted", func(t *testing.T) {
+		hits.Store(0)
+		fail.Store(2)
+		events, metas = nil, nil
+
+		_, _, err := client.Call[string](context.Background(), hooked.Get("/api/v1/hooked"))
+
+		assert.ErrorIs(t, err, retry.ErrExceedMaxRetry)
+		assert.Equal(t, []string{"before 1", "after 1", "retry 1", "before 2", "after 2", "give up 2"}, events)
+		assert.ErrorIs(t, metas[len(metas)-1].Err, retry.ErrExceedMaxRetry)
+	})
+}
+
+func TestResult(t *testing.T) {
+	type Greeting struct {
+		Message string `json:"message"`
+	}
+
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/greeting", func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Served-By", "greeter")
+		w.Write([]byte(`{"message":"hello"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Execute reports the request, final response and attempts", func(t *testing.T) {
+		var data Greeting
+		result, err := client.New("Greeter").
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/greeting"),
+				),
+				client.OnDoRequest(retry.Simple(3, 0, func(code int) bool { return code == http.StatusOK })...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, "hello", data.Message)
+		assert.Equal(t, "/api/v1/greeting", result.Request.GetPath())
+		assert.Equal(t, http.StatusOK, result.StatusCode())
+		assert.Equal(t, "greeter", result.Header().Get("X-Served-By"))
+		assert.Equal(t, 1, result.Retries())
+		assert.Greater(t, result.Duration, time.Duration(0))
+
+		require.Len(t, result.Attempts, 2)
+		assert.Equal(t, http.StatusServiceUnavailable, result.Attempts[0].StatusCode)
+		last, ok := result.Last()
+		require.True(t, ok)
+		assert.Equal(t, 2, last.Attempt)
+		assert.Greater(t, last.Timings.Total, time.Duration(0))
+	})
+
+	t.Run("SendDefault returns the result without a named client", func(t *testing.T) {
+		var data Greeting
+		result, err := client.SendDefault(
+			client.PrepareRequest(
+				request.Get(),
+				request.Domain(server.URL),
+				request.Path("/api/v1/greeting"),
+			),
+			client.PrepareResponse(
+				response.OnSuccess(
+					response.Decode(&data),
+				),
+			),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, "hello", data.Message)
+		assert.Equal(t, client.DefaultClientName, result.Attempts[0].Client)
+	})
+
+	t.Run("A failed request still reports its attempts", func(t *testing.T) {
+		result, err := client.SendDefault(
+			client.PrepareRequest(
+				request.Get(),
+				request.Domain("http://127.0.0.1:1"),
+				request.Path("/api/v1/greeting"),
+			),
+			client.PrepareResponse(
+				response.OnSuccess(),
+			),
+		)
+		require.Error(t, err)
+
+		require.Len(t, result.Attempts, 1)
+		assert.Error(t, result.Attempts[0].Err)
+		assert.Zero(t, result.StatusCode())
+	})
+}
+
+func TestTyped(t *testing.T) {
+	type User struct {
+		Id   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	type Problem struct {
+		Code string `json:"code"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.PathValue("id") == "0" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"user_not_found"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"id":%s,"name":"user %s"}`, r.PathValue("id"), r.PathValue("id"))
+	})
+	mux.HandleFunc("DELETE /api/v1/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/v1/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	users := client.New("Users").NoCoalesce()
+	get := func(path string) []request.RequestOptions {
+		return []request.RequestOptions{
+			request.Get(),
+			request.Domain(server.URL),
+			request.Path(path),
+		}
+	}
+
+	t.Run("Concurrent calls on a shared client decode their own value", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 1; i <= 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user, result, err := client.Do[User](context.Background(), users, get(fmt.Sprintf("/api/v1/users/%d", i))...)
+				assert.NoError(t, err)
+				assert.Equal(t, User{i, fmt.Sprintf("user %d", i)}, user)
+				assert.Equal(t, http.StatusOK, result.StatusCode())
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("No content leaves the zero value", func(t *testing.T) {
+		user, result, err := client.Do[User](context.Background(), users,
+			request.Delete(),
+			request.Domain(server.URL),
+			request.Path("/api/v1/users/1"),
+		)
+		assert.NoError(t, err)
+		assert.Zero(t, user)
+		assert.Equal(t, http.StatusNoContent, result.StatusCode())
+	})
+
+	t.Run("Undecodable body fails the call", func(t *testing.T) {
+		_, _, err := client.Do[User](context.Background(), users, get("/api/v1/broken")...)
+		assert.ErrorContains(t, err, "decode response body")
+	})
+
+	t.Run("DoErr returns the typed error body", func(t *testing.T) {
+		_, result, err := client.DoErr[User, Problem](context.Background(), users, get("/api/v1/users/0")...)
+
+		var status *client.StatusError[Problem]
+		require.ErrorAs(t, err, &status)
+		assert.Equal(t, http.StatusNotFound, status.StatusCode)
+		assert.Equal(t, "user_not_found", status.Body.Code)
+		assert.ErrorAs(t, err, &response.ResponseError{})
+		assert.Equal(t, http.StatusNotFound, result.StatusCode())
+	})
+}
+
+func TestTemplate(t *testing.T) {
+	type Item struct {
+		Path   string `json:"path"`
+		Lang   string `json:"lang"`
+		Page   string `json:"page"`
+		ApiKey string `json:"api_key"`
+		Trace  string `json:"trace"`
+	}
+
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/v2/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if r.URL.Path == "/v2/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Item{
+			Path:   r.Method + " " + r.URL.Path,
+			Lang:   r.URL.Query().Get("lang"),
+			Page:   r.URL.Query().Get("page"),
+			ApiKey: r.Header.Get("X-Api-Key"),
+			Trace:  r.Header.Get("X-Trace"),
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	errGone := errors.New("gone for good")
+	api, err := client.NewTemplate(client.New("Items").NoCoalesce(),
+		client.BaseURL(server.URL+"/v2/"),
+		client.DefaultHeader("X-Api-Key", "template-key"),
+		client.DefaultHeader("X-Trace", "on"),
+		client.DefaultQuery("lang", "en"),
+		client.DefaultRetry(retry.Simple(2, 0, func(code int) bool { return code == http.StatusOK })...),
+		client.DefaultTimeout(time.Second),
+		client.DefaultReject(response.OnNotFound(response.SetClientError(errGone.Error()))),
+	)
+	require.NoError(t, err)
+
+	t.Run("Endpoints add a method and path to the template defaults", func(t *testing.T) {
+		item, _, err := client.Call[Item](context.Background(), api.Get("items"))
+		require.NoError(t, err)
+		assert.Equal(t, Item{"GET /v2/items", "en", "", "template-key", "on"}, item)
+	})
+
+	t.Run("Endpoint options override the template", func(t *testing.T) {
+		item, _, err := client.Call[Item](context.Background(), api.Post("/items",
+			request.Query("lang", "fr"),
+			request.Query("page", "2"),
+			request.Header(request.SetRequestHeader("X-Api-Key", "endpoint-key")),
+		))
+		require.NoError(t, err)
+		assert.Equal(t, Item{"POST /v2/items", "fr", "2", "endpoint-key", "on"}, item)
+	})
+
+	t.Run("Template reject handlers and retry apply to every endpoint", func(t *testing.T) {
+		skip := response.OnSuccess(func(response.Response) response.ResponseErrorFunc {
+			return response.Skip()
+		})
+
+		hits.Store(0)
+		_, err := api.Get("missing").Send(context.Background(), skip)
+		assert.ErrorContains(t, err, errGone.Error())
+		assert.EqualValues(t, 2, hits.Load())
+
+		hits.Store(0)
+		_, err = api.Get("missing").Retry(retry.Simple(1, 0, func(code int) bool { return code == http.StatusOK })...).
+			Send(context.Background(), skip)
+		assert.Error(t, err)
+		assert.EqualValues(t, 1, hits.Load())
+	})
+
+	t.Run("Endpoint timeout overrides the template one", func(t *testing.T) {
+		_, _, err := client.Call[Item](context.Background(), api.Get("slow"))
+		assert.NoError(t, err)
+
+		_, _, err = client.Call[Item](context.Background(), api.Get("slow").Timeout(10*time.Millisecond))
+		assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	})
+
+	t.Run("Base URL must be absolute", func(t *testing.T) {
+		_, err := client.NewTemplate(client.New("Items"), client.BaseURL("/v2"))
+		assert.ErrorIs(t, err, client.ErrTemplateBaseURL)
+	})
+}
+
+func TestMethods(t *testing.T) {
+	type Info struct {
+		Method string `json:"method"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/resource", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS, PROPFIND")
+		w.Header().Set("X-Method", r.Method)
+		json.NewEncoder(w).Encode(Info{r.Method})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resource := func(method request.RequestOptions) []request.RequestOptions {
+		return []request.RequestOptions{
+			method,
+			request.Domain(server.URL),
+			request.Path("/api/v1/resource"),
+		}
+	}
+
+	t.Run("HEAD resolves without a body", func(t *testing.T) {
+		var info Info
+		result, err := client.New("Resource").
+			Register(
+				client.BeforeDoRequest(resource(request.Head())...),
+				client.OnDoRequest(retry.Default()...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&info),
+					),
+					response.OnReject(),
+				),
+			).Execute(context.Background())
+		require.NoError(t, err)
+
+		assert.Zero(t, info)
+		assert.Equal(t, "HEAD", result.Header().Get("X-Method"))
+	})
+
+	t.Run("HEAD needs no success action", func(t *testing.T) {
+		_, err := client.New("Resource").
+			Register(
+				client.BeforeDoRequest(resource(request.Head())...),
+				client.OnDoRequest(retry.Default()...),
+				client.AfterDoRequest(response.OnReject()),
+			).Execute(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("OPTIONS and arbitrary methods", func(t *testing.T) {
+		_, result, err := client.Do[Info](context.Background(), client.New("Resource"), resource(request.Options())...)
+		require.NoError(t, err)
+		assert.Contains(t, result.Header().Get("Allow"), "PROPFIND")
+
+		info, _, err := client.Do[Info](context.Background(), client.New("Resource"), resource(request.Method("PROPFIND"))...)
+		require.NoError(t, err)
+		assert.Equal(t, Info{"PROPFIND"}, info)
+	})
+
+	t.Run("Invalid method is rejected before sending", func(t *testing.T) {
+		_, result, err := client.Do[Info](context.Background(), client.New("Resource"), resource(request.Method("GET /"))...)
+		assert.ErrorIs(t, err, request.ErrRequestMethodInvalid)
+		assert.Empty(t, result.Attempts)
+	})
+}
+
+func TestPaginate(t *testing.T) {
+	const total = 23
+	items := make([]int, total)
+	for i := range items {
+		items[i] = i + 1
+	}
+	window := func(from, size int) []int {
+		from = min(from, total)
+		return items[from:min(from+size, total)]
+	}
+
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/pages", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": window((page-1)*size, size)})
+	})
+	mux.HandleFunc("GET /api/v1/offsets", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(window(offset, limit))
+	})
+	mux.HandleFunc("GET /api/v1/cursors", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		from, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		next := ""
+		if from+10 < total {
+			next = strconv.Itoa(from + 10)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"items": window(from, 10),
+			"meta":  map[string]any{"next": next},
+		})
+	})
+	var queries []string
+	mux.HandleFunc("GET /api/v1/links", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		queries = append(queries, r.URL.RawQuery)
+		from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+		if from+10 < total {
+			w.Header().Set("Link", fmt.Sprintf(`</api/v1/links?from=%d>; rel="next", </api/v1/links?from=0>; rel="first"`, from+10))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(window(from, 10))
+	})
+	mux.HandleFunc("GET /api/v1/failing", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[1,2]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pages := client.New("Pages").NoCoalesce()
+	at := func(path string) []request.RequestOptions {
+		return []request.RequestOptions{
+			request.Get(),
+			request.Domain(server.URL),
+			request.Path(path),
+		}
+	}
+	collect := func(t *testing.T, seq iter.Seq2[int, error]) []int {
+		var got []int
+		for item, err := range seq {
+			require.NoError(t, err)
+			got = append(got, item)
+		}
+		return got
+	}
+
+	t.Run("Page number", func(t *testing.T) {
+		hits.Store(0)
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.PageNumber("page", "per_page", 5), at("/api/v1/pages"), client.Items("data")))
+		assert.Equal(t, items, got)
+		assert.EqualValues(t, 5, hits.Load())
+	})
+
+	t.Run("Max pages", func(t *testing.T) {
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.PageNumber("page", "per_page", 5), at("/api/v1/pages"), client.Items("data"), client.MaxPages(2)))
+		assert.Equal(t, items[:10], got)
+	})
+
+	t.Run("Breaking stops fetching", func(t *testing.T) {
+		hits.Store(0)
+		var got []int
+		for item, err := range client.Paginate[int](context.Background(), pages,
+			client.OffsetLimit("offset", "limit", 4), at("/api/v1/offsets")) {
+			require.NoError(t, err)
+			got = append(got, item)
+			if len(got) == 6 {
+				break
+			}
+		}
+		assert.Equal(t, items[:6], got)
+		assert.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("Cursor from a JSON field", func(t *testing.T) {
+		hits.Store(0)
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.Cursor("cursor", "meta.next"), at("/api/v1/cursors"), client.Items("items")))
+		assert.Equal(t, items, got)
+		assert.EqualValues(t, 3, hits.Load())
+	})
+
+	t.Run("Link header", func(t *testing.T) {
+		hits.Store(0)
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.LinkHeader(), at("/api/v1/links")))
+		assert.Equal(t, items, got)
+		assert.EqualValues(t, 3, hits.Load())
+	})
+
+	t.Run("Link header replaces the whole query", func(t *testing.T) {
+		queries = nil
+		type Sort struct {
+			Sort string
+		}
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.LinkHeader(), append(at("/api/v1/links"), request.Query("filter", "new"), request.Param(Sort{"asc"}))))
+		assert.Equal(t, items, got)
+		assert.Equal(t, []string{"filter=new&sort=asc", "from=10", "from=20"}, queries)
+	})
+
+	t.Run("Offset and limit with prefetch", func(t *testing.T) {
+		got := collect(t, client.Paginate[int](context.Background(), pages,
+			client.OffsetLimit("offset", "limit", 4), at("/api/v1/offsets"), client.Prefetch(3)))
+		assert.Equal(t, items, got)
+	})
+
+	t.Run("Errors end the pagination", func(t *testing.T) {
+		var got []int
+		var errs []error
+		for item, err := range client.Paginate[int](context.Background(), pages,
+			client.PageNumber("page", "", 0), at("/api/v1/failing"), client.Prefetch(2)) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			got = append(got, item)
+		}
+		assert.Equal(t, []int{1, 2}, got)
+		require.Len(t, errs, 1)
+		assert.ErrorAs(t, errs[0], &response.ResponseError{})
+	})
+
+	t.Run("Missing items are an error, not a last page", func(t *testing.T) {
+		var errs []error
+		for _, err := range client.Paginate[int](context.Background(), pages,
+			client.PageNumber("page", "per_page", 5), at("/api/v1/pages"), client.Items("results")) {
+			errs = append(errs, err)
+		}
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], client.ErrPageItems)
+	})
+}
+
+func TestStream(t *testing.T) {
+	var connects atomic.Int32
+	var last_ids sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/format", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		io.WriteString(w, "\uFEFF: comment\r\n"+
+			"data: first\r\n"+
+			"data:  second\r\n\r\n"+
+			"event: update\rid: 7\rretry: 1500\rdata\r\r"+
+			"id: 8\nretry: soon\ndata: {\"a\":1}\n\n"+
+			"event: ignored\n\n"+
+			"data: cut short")
+	})
+	mux.HandleFunc("GET /api/v1/resume", func(w http.ResponseWriter, r *http.Request) {
+		n := connects.Add(1)
+		last_ids.Store(n, r.Header.Get("Last-Event-ID"))
+		if n == 3 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: %d\ndata: event %d\n\n", n, n)
+	})
+	mux.HandleFunc("GET /api/v1/down", func(w http.ResponseWriter, r *http.Request) {
+		connects.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("GET /api/v1/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /api/v1/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("GET /api/v1/live", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	events := client.New("Events")
+	at := func(path string) []request.RequestOptions {
+		return []request.RequestOptions{
+			request.Get(),
+			request.Domain(server.URL),
+			request.Path(path),
+		}
+	}
+	no_wait := client.Reconnect(retry.Simple(3, 0, func(int) bool { return false })...)
+
+	t.Run("Parses the event stream format", func(t *testing.T) {
+		var got []client.ServerEvent
+		var stream_err error
+		for ev, err := range client.Stream(context.Background(), events, at("/api/v1/format"), no_wait) {
+			if err != nil {
+				stream_err = err
+				break
+			}
+			got = append(got, ev)
+			if len(got) == 3 {
+				break
+			}
+		}
+		require.NoError(t, stream_err)
+
+		assert.Equal(t, []client.ServerEvent{
+			{Event: "message", Data: "first\n second"},
+			{ID: "7", Event: "update", Data: "", Retry: 1500 * time.Millisecond},
+			{ID: "8", Event: "message", Data: `{"a":1}`},
+		}, got)
+	})
+
+	t.Run("Reconnects with the last event id until a 204", func(t *testing.T) {
+		connects.Store(0)
+		var got []string
+		for ev, err := range client.Stream(context.Background(), events, at("/api/v1/resume"), no_wait, client.LastEventID("0")) {
+			require.NoError(t, err)
+			got = append(got, ev.Data)
+		}
+
+		assert.Equal(t, []string{"event 1", "event 2"}, got)
+		for n, expect := range []string{"0", "1", "2"} {
+			id, _ := last_ids.Load(int32(n + 1))
+			assert.Equal(t, expect, id)
+		}
+	})
+
+	t.Run("Gives up once reconnects are exhausted", func(t *testing.T) {
+		connects.Store(0)
+		var errs []error
+		for _, err := range client.Stream(context.Background(), events, at("/api/v1/down"), no_wait) {
+			errs = append(errs, err)
+		}
+
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], client.ErrStreamExhausted)
+		assert.EqualValues(t, 3, connects.Load())
+	})
+
+	t.Run("Rejected answers are not retried", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/missing", "/api/v1/json"} {
+			var errs []error
+			for _, err := range client.Stream(context.Background(), events, at(path), no_wait) {
+				errs = append(errs, err)
+			}
+
+			require.Len(t, errs, 1, path)
+			assert.ErrorIs(t, errs[0], client.ErrStreamRejected, path)
+		}
+	})
+
+	t.Run("Events are delivered on a channel until cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := client.Events(ctx, events, at("/api/v1/live"))
+
+		first := <-out
+		require.NoError(t, first.Err)
+		assert.Equal(t, "hello", first.Event.Data)
+
+		cancel()
+		select {
+		case result, ok := <-out:
+			assert.False(t, ok, "unexpected %v", result)
+		case <-time.After(time.Second):
+			t.Fatal("stream did not end on cancel")
+		}
+	})
+
+	t.Run("Cancelling cuts the reconnect interval", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		for _, err := range client.Stream(ctx, events, at("/api/v1/down"),
+			client.Reconnect(retry.Simple(3, time.Hour, func(int) bool { return false })...)) {
+			assert.NoError(t, err)
+		}
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+// coalesceIgnored lists the headers that differ between otherwise identical
+// calls and therefore do not split a flight.
+var coalesceIgnored = map[string]bool{
+	"Traceparent":        true,
+	"Tracestate":         true,
+	"X-Request-Id":       true,
+	IdempotencyKeyHeader: true,
+}
+
+// coalesceMaxBody is the largest body a flight buffers to share it. Waiters
+// of a larger response send their own call instead.
+const coalesceMaxBody = 1 << 20
+
+// errFlightTooLarge tells the waiters of a flight to send their own call.
+var errFlightTooLarge = errors.New("coalesced response too large to share")
+
+var flights = &flightGroup{calls: map[string]*flight{}}
+
+// NoCoalesce returns a copy of the client whose GET and HEAD attempts always
+// go to the network, even when an identical one is already in flight.
+func (c Client) NoCoalesce() Client {
+	c.no_coalesce = true
+	return c
+}
+
+// coalesces reports whether req may share a flight with the calls of other
+// clients. Credentials, signatures, transports and middlewares may differ
+// between clients of the same name, and traces belong to a single caller, so
+// clients using any of them always send their own calls.
+func (c Client) coalesces(req request.Request) bool {
+	if c.no_coalesce || c.auth != nil || c.signer != nil || c.transport != nil || c.tracer != nil {
+		return false
+	}
+	if len(c.middlewares) > 0 || len(globalMiddlewares()) > 0 {
+		return false
+	}
+
+	method := req.GetMethod()
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// flightKey identifies identical calls: the same client, method, URL and
+// headers.
+func (c Client) flightKey(req request.Request) string {
+	var b strings.Builder
+	b.WriteString(c.Name + "\n" + req.GetMethod() + " " + req.GetUrl() + "\n")
+
+	header := req.GetHeaders()
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if !coalesceIgnored[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		b.WriteString(name + ": " + strings.Join(header[name], ",") + "\n")
+	}
+
+	return b.String()
+}
+
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a call shared by every waiter with the same key. It runs apart
+// from the waiters' contexts, and without their values but the timing
+// recorder of the first one, and is only cancelled once all of them left.
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	resp *http.Response
+	// sole is set when a single waiter is left, which gets resp as is.
+	sole bool
+	body []byte
+	err  error
+}
+
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	g.mu.Lock()
+	f, ok := g.calls[key]
+	if !ok {
+		call_ctx, cancel := context.WithCancel(detachedTimings(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+		go g.run(call_ctx, key, f, fn)
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		if errors.Is(f.err, errFlightTooLarge) {
+			return fn(ctx)
+		}
+		return f.result()
+
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		left := f.waiters == 0
+		if left {
+			f.cancel()
+			g.forget(key, f)
+		}
+		g.mu.Unlock()
+
+		if left {
+			go f.discard()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// discard closes a response handed over to a waiter that already left.
+func (f *flight) discard() {
+	<-f.done
+	if f.sole && f.resp != nil {
+		f.resp.Body.Close()
+	}
+}
+
+// run sends the call. A response with a single waiter left is handed over
+// unread, otherwise its body is buffered for every waiter to read.
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(context.Context) (*http.Response, error)) {
+	resp, err := fn(ctx)
+
+	// Later calls start a new flight, so the waiters are known from here.
+	g.mu.Lock()
+	g.forget(key, f)
+	f.sole = f.waiters == 1
+	g.mu.Unlock()
+
+	switch {
+	case err != nil:
+		f.cancel()
+		f.err = err
+
+	case f.sole:
+		resp.Body = &cancelOnClose{resp.Body, f.cancel}
+		f.resp = resp
+
+	default:
+		f.body, f.err = readShared(resp)
+		resp.Body.Close()
+		f.cancel()
+		f.resp = resp
+	}
+
+	close(f.done)
+}
+
+func readShared(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > coalesceMaxBody {
+		return nil, errFlightTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, coalesceMaxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > coalesceMaxBody {
+		return nil, errFlightTooLarge
+	}
+
+	return body, nil
+}
+
+// forget lets later calls start a new flight. It must be called with g.mu
+// held.
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.calls[key] == f {
+		delete(g.calls, key)
+	}
+}
+
+// result gives every waiter its own copy of the response.
+func (f *flight) result() (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.sole {
+		return f.resp, nil
+	}
+
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(f.body))
+	return &resp, nil
+}
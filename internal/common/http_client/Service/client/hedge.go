@@ -0,0 +1,286 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/breaker"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/ratelimit"
+)
+
+var (
+	ErrInvalidHedgeAttempts   = errors.New("hedge needs at least two attempts")
+	ErrInvalidHedgeDelay      = errors.New("hedge delay has to be positive")
+	ErrInvalidHedgePercentile = errors.New("hedge percentile has to be within (0, 100)")
+)
+
+// hedgeSamples is the number of recent latencies kept to derive the delay.
+const hedgeSamples = 128
+
+// HedgePolicy fires extra identical attempts for idempotent requests when the
+// first one is slow, and keeps whichever answers successfully first.
+type HedgePolicy struct {
+	attempts    int
+	delay       time.Duration
+	percentile  float64
+	min_samples int
+
+	stats *hedgeStats
+}
+
+type HedgeStats struct {
+	// Requests counts hedged Send attempts, Hedges the extra calls fired for
+	// them and Wins the times an extra call answered first.
+	Requests uint64
+	Hedges   uint64
+	Wins     uint64
+}
+
+type hedgeStats struct {
+	requests atomic.Uint64
+	hedges   atomic.Uint64
+	wins     atomic.Uint64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+type HedgeOptions func(HedgePolicy) HedgePolicy
+
+// HedgeAttempts is the maximum number of concurrent calls, including the
+// first one.
+func HedgeAttempts(n int) HedgeOptions {
+	return func(p HedgePolicy) HedgePolicy {
+		p.attempts = n
+		return p
+	}
+}
+
+// HedgeDelay waits d before firing each extra call.
+func HedgeDelay(d time.Duration) HedgeOptions {
+	return func(p HedgePolicy) HedgePolicy {
+		p.delay = d
+		return p
+	}
+}
+
+// HedgePercentile waits for the given latency percentile of recent successful
+// calls instead, once min_samples are known. HedgeDelay stays the fallback.
+func HedgePercentile(percentile float64, min_samples int) HedgeOptions {
+	return func(p HedgePolicy) HedgePolicy {
+		p.percentile = percentile
+		p.min_samples = min_samples
+		return p
+	}
+}
+
+func NewHedge(opts ...HedgeOptions) (HedgePolicy, error) {
+	p := HedgePolicy{
+		attempts: 2,
+		stats:    &hedgeStats{},
+	}
+	for _, opt := range opts {
+		p = opt(p)
+	}
+
+	switch {
+	case p.attempts < 2:
+		return HedgePolicy{}, ErrInvalidHedgeAttempts
+	case p.delay <= 0:
+		return HedgePolicy{}, ErrInvalidHedgeDelay
+	case p.percentile < 0 || p.percentile >= 100:
+		return HedgePolicy{}, ErrInvalidHedgePercentile
+	}
+
+	return p, nil
+}
+
+func (p HedgePolicy) Stats() HedgeStats {
+	return HedgeStats{
+		Requests: p.stats.requests.Load(),
+		Hedges:   p.stats.hedges.Load(),
+		Wins:     p.stats.wins.Load(),
+	}
+}
+
+func (p HedgePolicy) nextDelay() time.Duration {
+	if p.percentile == 0 {
+		return p.delay
+	}
+
+	p.stats.mu.Lock()
+	samples := slices.Clone(p.stats.latencies)
+	p.stats.mu.Unlock()
+
+	if len(samples) == 0 || len(samples) < p.min_samples {
+		return p.delay
+	}
+
+	slices.Sort(samples)
+	return samples[int(float64(len(samples))*p.percentile/100)]
+}
+
+func (p HedgePolicy) observe(latency time.Duration) {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+
+	if len(p.stats.latencies) < hedgeSamples {
+		p.stats.latencies = append(p.stats.latencies, latency)
+		return
+	}
+	p.stats.latencies[p.stats.next] = latency
+	p.stats.next = (p.stats.next + 1) % hedgeSamples
+}
+
+// Hedge returns a copy of the client that hedges GET, HEAD and OPTIONS
+// requests with p. Hedges are counted by the policy, apart from retries, and
+// each of them takes its own rate limit permit and breaker admission.
+func (c Client) Hedge(p HedgePolicy) Client {
+	c.hedge = &p
+	return c
+}
+
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+type hedgeOutcome struct {
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+	index   int
+	latency time.Duration
+}
+
+func (o hedgeOutcome) succeeded() bool {
+	return o.err == nil && o.resp.StatusCode < http.StatusInternalServerError
+}
+
+// discard releases a call that lost the race.
+func (o hedgeOutcome) discard() {
+	if o.resp != nil {
+		o.resp.Body.Close()
+	}
+	o.cancel()
+}
+
+// keep hands the response over to the caller, cancelling the call context
+// only once the body has been closed.
+func (o hedgeOutcome) keep() (*http.Response, error) {
+	if o.err != nil {
+		o.cancel()
+		return nil, o.err
+	}
+
+	o.resp.Body = &cancelOnClose{o.resp.Body, o.cancel}
+	return o.resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (c Client) hedged(ctx context.Context, req request.Request) (*http.Response, error) {
+	p := c.hedge
+	if p == nil || !isSafe(req.GetMethod()) {
+		return c.guarded(ctx, req)
+	}
+	p.stats.requests.Add(1)
+
+	results := make(chan hedgeOutcome, p.attempts)
+	cancels := make([]context.CancelFunc, 0, p.attempts)
+	launch := func() {
+		call_ctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		index := len(cancels) - 1
+		if index > 0 {
+			p.stats.hedges.Add(1)
+		}
+
+		go func() {
+			start := time.Now()
+			resp, err := c.guarded(call_ctx, req)
+			results <- hedgeOutcome{resp, err, cancel, index, time.Since(start)}
+		}()
+	}
+
+	launch()
+	pending := 1
+	timer := time.NewTimer(p.nextDelay())
+	defer timer.Stop()
+
+	var last *hedgeOutcome
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) < p.attempts {
+				launch()
+				pending++
+				timer.Reset(p.nextDelay())
+			}
+
+		case o := <-results:
+			pending--
+			if o.succeeded() {
+				p.observe(o.latency)
+				if o.index > 0 {
+					p.stats.wins.Add(1)
+				}
+
+				for i, cancel := range cancels {
+					if i != o.index {
+						cancel()
+					}
+				}
+				go drain(results, pending)
+				return o.keep()
+			}
+
+			if last != nil {
+				last.discard()
+			}
+			last = &o
+
+			// Every call so far failed, do not wait for the timer unless the
+			// upstream is refusing calls.
+			if pending == 0 && len(cancels) < p.attempts && ctx.Err() == nil && !refused(o.err) {
+				launch()
+				pending++
+			}
+		}
+	}
+
+	return last.keep()
+}
+
+// refused reports whether err comes from the limiter or the breaker rather
+// than from the upstream.
+func refused(err error) bool {
+	return errors.Is(err, ratelimit.ErrRateLimited) || errors.Is(err, breaker.ErrCircuitOpen)
+}
+
+func drain(results <-chan hedgeOutcome, pending int) {
+	for range pending {
+		(<-results).discard()
+	}
+}
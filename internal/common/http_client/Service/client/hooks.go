@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+// Timings break an attempt down with net/http/httptrace. Phases that did not
+// happen, such as DNS on a reused connection, stay zero.
+type Timings struct {
+	DNS             time.Duration
+	Connect         time.Duration
+	TLS             time.Duration
+	TimeToFirstByte time.Duration
+	Total           time.Duration
+	// Reused reports whether the connection came from the pool.
+	Reused bool
+}
+
+// AttemptMeta describes one attempt. StatusCode and Timings are only set once
+// the attempt is over.
+type AttemptMeta struct {
+	Client     string
+	Attempt    int
+	Method     string
+	Url        string
+	StatusCode int
+	Err        error
+	Timings    Timings
+}
+
+// Hooks are called around every attempt of a Send. Any of them may be nil.
+// Hedged calls share one AttemptMeta, and coalesced calls only time the call
+// that actually went out.
+type Hooks struct {
+	BeforeAttempt func(context.Context, AttemptMeta)
+	AfterAttempt  func(context.Context, AttemptMeta)
+	// OnRetry receives the attempt about to be retried, right before the
+	// next one starts.
+	OnRetry func(context.Context, AttemptMeta)
+	// OnGiveUp receives the last attempt when Send stops without an accepted
+	// answer: retries or the retry budget exhausted, or an attempt failed.
+	OnGiveUp func(context.Context, AttemptMeta)
+}
+
+// Hooks returns a copy of the client calling h around every attempt.
+func (c Client) Hooks(h Hooks) Client {
+	c.hooks = &h
+	return c
+}
+
+func (h *Hooks) beforeAttempt(ctx context.Context, meta AttemptMeta) {
+	if h != nil && h.BeforeAttempt != nil {
+		h.BeforeAttempt(ctx, meta)
+	}
+}
+
+func (h *Hooks) afterAttempt(ctx context.Context, meta AttemptMeta) {
+	if h != nil && h.AfterAttempt != nil {
+		h.AfterAttempt(ctx, meta)
+	}
+}
+
+func (h *Hooks) onRetry(ctx context.Context, meta AttemptMeta) {
+	if h != nil && h.OnRetry != nil {
+		h.OnRetry(ctx, meta)
+	}
+}
+
+func (h *Hooks) onGiveUp(ctx context.Context, meta AttemptMeta) {
+	if h != nil && h.OnGiveUp != nil {
+		h.OnGiveUp(ctx, meta)
+	}
+}
+
+// tracked runs and times attempt n of req.
+func (c Client) tracked(ctx context.Context, req request.Request, n int) (*http.Response, AttemptMeta, error) {
+	ctx = withAttempt(ctx, AttemptInfo{c.Name, n, c.streaming})
+	meta := AttemptMeta{
+		Client:  c.Name,
+		Attempt: n,
+		Method:  req.GetMethod(),
+		Url:     req.GetUrl(),
+	}
+
+	rec := &timingRecorder{}
+	ctx = context.WithValue(ctx, timingKey{}, rec)
+	c.hooks.beforeAttempt(ctx, meta)
+
+	start := time.Now()
+	http_resp, err := c.attempt(ctx, req)
+	meta.Timings = rec.timings()
+	meta.Timings.Total = time.Since(start)
+	meta = meta.done(http_resp, err)
+
+	c.hooks.afterAttempt(ctx, meta)
+	return http_resp, meta, err
+}
+
+func (m AttemptMeta) done(http_resp *http.Response, err error) AttemptMeta {
+	m.Err = err
+	if err == nil {
+		m.StatusCode = http_resp.StatusCode
+	}
+	return m
+}
+
+type timingKey struct{}
+
+// detachedTimings is a context without any value of ctx but its timing
+// recorder, for calls shared with other attempts.
+func detachedTimings(ctx context.Context) context.Context {
+	rec, ok := ctx.Value(timingKey{}).(*timingRecorder)
+	if !ok {
+		return context.Background()
+	}
+
+	return context.WithValue(context.Background(), timingKey{}, rec)
+}
+
+// withClientTrace attaches the timing recorder of the attempt, if any, to
+// the exchange context.
+func withClientTrace(ctx context.Context) context.Context {
+	rec, ok := ctx.Value(timingKey{}).(*timingRecorder)
+	if !ok {
+		return ctx
+	}
+
+	return httptrace.WithClientTrace(ctx, rec.trace())
+}
+
+type timingRecorder struct {
+	mu sync.Mutex
+	t  Timings
+
+	start         time.Time
+	dns_start     time.Time
+	connect_start time.Time
+	tls_start     time.Time
+}
+
+func (r *timingRecorder) timings() Timings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.t
+}
+
+func (r *timingRecorder) trace() *httptrace.ClientTrace {
+	at := func(fn func(now time.Time)) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		fn(time.Now())
+	}
+
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			at(func(now time.Time) { r.start = now })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			at(func(time.Time) { r.t.Reused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			at(func(now time.Time) { r.dns_start = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			at(func(now time.Time) { r.t.DNS = now.Sub(r.dns_start) })
+		},
+		ConnectStart: func(string, string) {
+			at(func(now time.Time) {
+				if r.connect_start.IsZero() {
+					r.connect_start = now
+				}
+			})
+		},
+		ConnectDone: func(string, string, error) {
+			at(func(now time.Time) { r.t.Connect = now.Sub(r.connect_start) })
+		},
+		TLSHandshakeStart: func() {
+			at(func(now time.Time) { r.tls_start = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			at(func(now time.Time) { r.t.TLS = now.Sub(r.tls_start) })
+		},
+		GotFirstResponseByte: func() {
+			at(func(now time.Time) { r.t.TimeToFirstByte = now.Sub(r.start) })
+		},
+	}
+}
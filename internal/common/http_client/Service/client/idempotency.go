@@ -0,0 +1,63 @@
+package client
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// isIdempotent follows RFC 9110: repeating these methods has the same effect
+// on the upstream as sending them once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// RetryNonIdempotent returns a copy of the client that also retries methods
+// such as POST and PATCH. Only opt in when the upstream deduplicates them,
+// e.g. with IdempotencyKey.
+func (c Client) RetryNonIdempotent() Client {
+	c.retry_non_idempotent = true
+	return c
+}
+
+// IdempotencyKey returns a copy of the client that sends a generated
+// Idempotency-Key header, the same for every attempt of a single Send. A key
+// already set on the request is kept.
+func (c Client) IdempotencyKey() Client {
+	c.idempotency_key = true
+	return c
+}
+
+func (c Client) canRetry(req request.Request) bool {
+	return c.retry_non_idempotent || isIdempotent(req.GetMethod())
+}
+
+func (c Client) withIdempotencyKey(req request.Request) request.Request {
+	if !c.idempotency_key || req.GetHeader(IdempotencyKeyHeader) != "" {
+		return req
+	}
+
+	return request.Header(
+		request.SetRequestHeader(IdempotencyKeyHeader, newUUID()),
+	)(req)
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+// Doer performs a single HTTP exchange.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts an ordinary function to the Doer interface.
+type DoerFunc func(*http.Request) (*http.Response, error)
+
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer with cross-cutting behaviour such as auth
+// injection, logging or metrics.
+type Middleware func(next Doer) Doer
+
+var global = struct {
+	mu          sync.RWMutex
+	middlewares []Middleware
+}{}
+
+// Use appends middlewares to the chain applied by every client. Global
+// middlewares always wrap the ones registered on a single client.
+func Use(mws ...Middleware) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	global.middlewares = append(global.middlewares, mws...)
+}
+
+// ResetMiddlewares removes every global middleware.
+func ResetMiddlewares() {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	global.middlewares = nil
+}
+
+func globalMiddlewares() []Middleware {
+	global.mu.RLock()
+	defer global.mu.RUnlock()
+
+	return slices.Clone(global.middlewares)
+}
+
+// Chain wraps base with mws. The first middleware is the outermost one, so
+// it sees the request first and the response last.
+func Chain(base Doer, mws ...Middleware) Doer {
+	d := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		d = mws[i](d)
+	}
+
+	return d
+}
+
+// Use returns a copy of the client with mws appended to its own chain.
+func (c Client) Use(mws ...Middleware) Client {
+	c.middlewares = append(slices.Clone(c.middlewares), mws...)
+	return c
+}
+
+// doer sends req through the middleware chain, signing it last.
+func (c Client) doer(req request.Request) Doer {
+	var d Doer = &http.Client{Transport: c.transport}
+	if c.signer != nil {
+		d = signed(c.signer, req, d)
+	}
+
+	mws := append(globalMiddlewares(), c.middlewares...)
+	return Chain(d, mws...)
+}
+
+func signed(s Signer, req request.Request, next Doer) Doer {
+	return DoerFunc(func(http_req *http.Request) (*http.Response, error) {
+		if err := s.Sign(req, http_req); err != nil {
+			return nil, fmt.Errorf("%w:%v", ErrSign, err)
+		}
+
+		return next.Do(http_req)
+	})
+}
@@ -0,0 +1,439 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+var (
+	ErrPageItems = errors.New("page items are missing or do not decode")
+	ErrPageLink  = errors.New("next page link is invalid")
+)
+
+// PageState describes the page just fetched, from which a strategy builds
+// the request of the next one.
+type PageState struct {
+	// Index counts pages from 0.
+	Index  int
+	Items  int
+	Body   json.RawMessage
+	Header http.Header
+	Url    string
+}
+
+// PageStrategy builds the request options of page n, added after the ones
+// given to Paginate, from the page before it, nil for the first page. It
+// returns false once there are no more pages. Paginate always stops after a
+// page without items.
+type PageStrategy interface {
+	Page(n int, prev *PageState) ([]request.RequestOptions, bool)
+}
+
+// IndexedStrategy is a strategy knowing the request of any page up front,
+// which lets Paginate fetch pages ahead with Prefetch.
+type IndexedStrategy interface {
+	PageStrategy
+	PageAt(n int) []request.RequestOptions
+}
+
+type pageNumber struct {
+	param      string
+	size_param string
+	size       int
+}
+
+// PageNumber asks for pages 1, 2, ... in param, of size items given in
+// size_param. A page shorter than size is the last one. A zero size leaves
+// the page size to the upstream.
+func PageNumber(param, size_param string, size int) IndexedStrategy {
+	return pageNumber{param, size_param, size}
+}
+
+func (p pageNumber) PageAt(n int) []request.RequestOptions {
+	opts := []request.RequestOptions{request.Query(p.param, strconv.Itoa(n+1))}
+	if p.size > 0 {
+		opts = append(opts, request.Query(p.size_param, strconv.Itoa(p.size)))
+	}
+
+	return opts
+}
+
+func (p pageNumber) Page(n int, prev *PageState) ([]request.RequestOptions, bool) {
+	if prev != nil && p.size > 0 && prev.Items < p.size {
+		return nil, false
+	}
+
+	return p.PageAt(n), true
+}
+
+type offsetLimit struct {
+	offset_param string
+	limit_param  string
+	limit        int
+}
+
+// OffsetLimit asks for limit items at offsets 0, limit, 2*limit, ... A page
+// shorter than limit is the last one.
+func OffsetLimit(offset_param, limit_param string, limit int) IndexedStrategy {
+	return offsetLimit{offset_param, limit_param, max(limit, 1)}
+}
+
+func (o offsetLimit) PageAt(n int) []request.RequestOptions {
+	return []request.RequestOptions{
+		request.Query(o.offset_param, strconv.Itoa(n*o.limit)),
+		request.Query(o.limit_param, strconv.Itoa(o.limit)),
+	}
+}
+
+func (o offsetLimit) Page(n int, prev *PageState) ([]request.RequestOptions, bool) {
+	if prev != nil && prev.Items < o.limit {
+		return nil, false
+	}
+
+	return o.PageAt(n), true
+}
+
+type cursor struct {
+	param string
+	field string
+}
+
+// Cursor sends the cursor read from field of the page before, a dotted path
+// into its JSON body such as "meta.next_cursor", in param. An empty, null or
+// missing cursor ends the pagination.
+func Cursor(param, field string) PageStrategy {
+	return cursor{param, field}
+}
+
+func (c cursor) Page(n int, prev *PageState) ([]request.RequestOptions, bool) {
+	if prev == nil {
+		return nil, true
+	}
+
+	raw, ok := jsonPath(prev.Body, c.field)
+	if !ok {
+		return nil, false
+	}
+
+	var next any
+	if err := json.Unmarshal(raw, &next); err != nil {
+		return nil, false
+	}
+
+	var value string
+	switch next := next.(type) {
+	case string:
+		value = next
+	case float64:
+		value = string(raw)
+	}
+	if value == "" {
+		return nil, false
+	}
+
+	return []request.RequestOptions{request.Query(c.param, value)}, true
+}
+
+type linkHeader struct{}
+
+// LinkHeader follows the rel="next" URL of the Link header, RFC 8288, which
+// replaces the domain, path and query of the request, Param included.
+func LinkHeader() PageStrategy {
+	return linkHeader{}
+}
+
+func (linkHeader) Page(n int, prev *PageState) ([]request.RequestOptions, bool) {
+	if prev == nil {
+		return nil, true
+	}
+
+	next, ok := nextLink(prev.Header)
+	if !ok {
+		return nil, false
+	}
+
+	return []request.RequestOptions{
+		func(r request.Request) request.Request {
+			return withLink(r, prev.Url, next)
+		},
+	}, true
+}
+
+func nextLink(h http.Header) (string, bool) {
+	for _, value := range h.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				key, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "rel") && slices.Contains(strings.Fields(strings.Trim(rel, `"`)), "next") {
+					return target[1 : len(target)-1], true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// withLink points r to link, resolved against the URL of the page before.
+// An unusable link leaves a domain that fails request validation.
+func withLink(r request.Request, base, link string) request.Request {
+	b, err := url.Parse(base)
+	if err != nil {
+		return request.Domain(fmt.Sprintf("%s:%v", ErrPageLink, err))(r)
+	}
+	u, err := b.Parse(link)
+	if err != nil {
+		return request.Domain(fmt.Sprintf("%s:%v", ErrPageLink, err))(r)
+	}
+
+	r = request.Domain(u.Scheme + "://" + u.Host)(r)
+	r = request.Path(u.EscapedPath())(r)
+	r = request.Queries(u.Query())(r)
+	r = request.Param(nil)(r)
+
+	return r
+}
+
+// jsonPath looks up a dotted path of object keys in body. An empty path is
+// the body itself.
+func jsonPath(body json.RawMessage, path string) (json.RawMessage, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+	if path == "" {
+		return body, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, false
+		}
+
+		var ok bool
+		if body, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return body, true
+}
+
+type PaginateConfig struct {
+	items     string
+	max_pages int
+	prefetch  int
+}
+
+type PaginateOptions func(PaginateConfig) PaginateConfig
+
+// Items sets the dotted path of the item array in every page, e.g. "data".
+// By default the page body is the array.
+func Items(path string) PaginateOptions {
+	return func(c PaginateConfig) PaginateConfig {
+		c.items = path
+		return c
+	}
+}
+
+func MaxPages(n int) PaginateOptions {
+	return func(c PaginateConfig) PaginateConfig {
+		c.max_pages = n
+		return c
+	}
+}
+
+// Prefetch fetches up to n pages ahead of the one being read, for indexed
+// strategies only. Pages are still yielded in order and prefetched pages past
+// the last one are dropped.
+func Prefetch(n int) PaginateOptions {
+	return func(c PaginateConfig) PaginateConfig {
+		c.prefetch = n
+		return c
+	}
+}
+
+type fetchedPage struct {
+	state PageState
+	err   error
+}
+
+// Paginate yields the items of every page of the request built from reqOpts,
+// sending one request per page through c as strategy says. Fetching stops
+// at the first error, which is yielded with the zero T, or when the loop
+// breaks.
+func Paginate[T any](
+	ctx context.Context,
+	c Client,
+	strategy PageStrategy,
+	reqOpts []request.RequestOptions,
+	opts ...PaginateOptions,
+) iter.Seq2[T, error] {
+	cfg := PaginateConfig{}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		pages, wait := c.pages(ctx, strategy, reqOpts, cfg)
+		defer func() {
+			cancel()
+			wait()
+		}()
+
+		var zero T
+		for n := 0; cfg.max_pages <= 0 || n < cfg.max_pages; n++ {
+			page, ok := pages(n)
+			if !ok {
+				return
+			}
+			if page.err != nil {
+				yield(zero, page.err)
+				return
+			}
+
+			items, err := pageItems[T](page.state.Body, cfg.items)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if len(items) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// pages returns the fetcher of page n, called for n = 0, 1, ... in order,
+// and a wait for the pages fetched ahead to give up once ctx is cancelled.
+func (c Client) pages(
+	ctx context.Context,
+	strategy PageStrategy,
+	reqOpts []request.RequestOptions,
+	cfg PaginateConfig,
+) (func(n int) (fetchedPage, bool), func()) {
+	var prev *PageState
+	next := func(n int) (fetchedPage, bool) {
+		page_opts, ok := strategy.Page(n, prev)
+		if !ok {
+			return fetchedPage{}, false
+		}
+
+		page := c.fetchPage(ctx, n, reqOpts, page_opts, cfg.items)
+		prev = &page.state
+		return page, true
+	}
+
+	indexed, ok := strategy.(IndexedStrategy)
+	if !ok || cfg.prefetch <= 0 {
+		return next, func() {}
+	}
+
+	var wg sync.WaitGroup
+	ahead := make(chan chan fetchedPage, cfg.prefetch)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ahead)
+		for n := 0; cfg.max_pages <= 0 || n < cfg.max_pages; n++ {
+			fetched := make(chan fetchedPage, 1)
+			select {
+			case ahead <- fetched:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fetched <- c.fetchPage(ctx, n, reqOpts, indexed.PageAt(n), cfg.items)
+			}()
+		}
+	}()
+
+	return func(n int) (fetchedPage, bool) {
+		if _, ok := strategy.Page(n, prev); !ok {
+			return fetchedPage{}, false
+		}
+
+		fetched, ok := <-ahead
+		if !ok {
+			return fetchedPage{}, false
+		}
+
+		page := <-fetched
+		prev = &page.state
+		return page, true
+	}, wg.Wait
+}
+
+func (c Client) fetchPage(
+	ctx context.Context,
+	n int,
+	reqOpts []request.RequestOptions,
+	page_opts []request.RequestOptions,
+	items string,
+) fetchedPage {
+	body, result, err := Do[json.RawMessage](ctx, c, slices.Concat(reqOpts, page_opts)...)
+	if err != nil {
+		return fetchedPage{err: err}
+	}
+
+	state := PageState{
+		Index:  n,
+		Body:   body,
+		Header: result.Header(),
+		Url:    result.Request.GetUrl(),
+	}
+	list, err := pageItems[json.RawMessage](body, items)
+	if err != nil {
+		return fetchedPage{state, err}
+	}
+	state.Items = len(list)
+
+	return fetchedPage{state: state}
+}
+
+// pageItems decodes the items of a page. Only an empty body has no items: a
+// path missing from the body is an error, not an empty last page.
+func pageItems[T any](body json.RawMessage, path string) ([]T, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	raw, ok := jsonPath(body, path)
+	if !ok {
+		return nil, fmt.Errorf("%w:no %q in the page", ErrPageItems, path)
+	}
+
+	var items []T
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("%w:%v", ErrPageItems, err)
+	}
+
+	return items, nil
+}
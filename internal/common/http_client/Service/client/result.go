@@ -0,0 +1,43 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+)
+
+// Result describes a finished Execute. The body has already gone to the
+// resolvers of the response, e.g. a response.Decode target, so Response only
+// holds the metadata of the final answer.
+type Result struct {
+	// Request is the request as sent, idempotency key included.
+	Request  request.Request
+	Response response.Response
+	// Attempts holds one entry per attempt, in order.
+	Attempts []AttemptMeta
+	Duration time.Duration
+}
+
+// StatusCode is the status of the final answer, zero when none was resolved.
+func (r Result) StatusCode() int {
+	return r.Response.GetStatusCode()
+}
+
+func (r Result) Header() http.Header {
+	return r.Response.GetHeader()
+}
+
+func (r Result) Retries() int {
+	return max(len(r.Attempts)-1, 0)
+}
+
+// Last returns the final attempt, if any was made.
+func (r Result) Last() (AttemptMeta, bool) {
+	if len(r.Attempts) == 0 {
+		return AttemptMeta{}, false
+	}
+
+	return r.Attempts[len(r.Attempts)-1], true
+}
@@ -0,0 +1,362 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+)
+
+const EventStreamContentType = "text/event-stream"
+
+var (
+	ErrStreamRejected  = errors.New("event stream rejected")
+	ErrStreamExhausted = errors.New("event stream reconnects exhausted")
+)
+
+// ServerEvent is one event of a text/event-stream.
+type ServerEvent struct {
+	// ID is the last event ID seen on the stream, sent back as Last-Event-ID
+	// on reconnect.
+	ID string
+	// Event is the event type, "message" when the server gave none.
+	Event string
+	Data  string
+	// Retry is the reconnection delay set by the retry field of this event,
+	// zero when it had none.
+	Retry time.Duration
+}
+
+// StreamResult is what Events delivers: an event, or the error that ended
+// the stream.
+type StreamResult struct {
+	Event ServerEvent
+	Err   error
+}
+
+type StreamConfig struct {
+	reconnect     []retry.RetryOptions
+	last_event_id string
+}
+
+type StreamOptions func(StreamConfig) StreamConfig
+
+// Reconnect sets the policy for consecutive failed connections. Only its
+// attempts and interval are used: a connection is a failure when it cannot
+// be opened, answers a 408, 429 or 5xx, or ends. The streak restarts after
+// any delivered event.
+func Reconnect(opts ...retry.RetryOptions) StreamOptions {
+	return func(c StreamConfig) StreamConfig {
+		c.reconnect = opts
+		return c
+	}
+}
+
+// LastEventID resumes a stream after the event id.
+func LastEventID(id string) StreamOptions {
+	return func(c StreamConfig) StreamConfig {
+		c.last_event_id = id
+		return c
+	}
+}
+
+// DefaultReconnect makes 5 attempts a second apart.
+func DefaultReconnect() []retry.RetryOptions {
+	return retry.Simple(5, time.Second, func(int) bool { return false })
+}
+
+// Stream opens the request built from reqOpts as an event stream and yields
+// its events until ctx is cancelled, which ends the loop without error. Lost
+// connections are reopened with Last-Event-ID as Reconnect says, waiting the
+// delay asked by the server on top of the policy interval. A 204 ends the
+// stream; other answers than 200 text/event-stream are ErrStreamRejected.
+//
+// Connections skip coalescing and hedging and are never cached.
+func Stream(
+	ctx context.Context,
+	c Client,
+	reqOpts []request.RequestOptions,
+	opts ...StreamOptions,
+) iter.Seq2[ServerEvent, error] {
+	cfg := StreamConfig{reconnect: DefaultReconnect()}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	c.no_coalesce = true
+	c.hedge = nil
+	c.streaming = true
+
+	return func(yield func(ServerEvent, error) bool) {
+		last_id := cfg.last_event_id
+		var delay time.Duration
+		var retrier retry.Retry
+		streak := false
+
+		for n := 1; ; n++ {
+			if !streak {
+				r, err := retry.New(cfg.reconnect...)
+				if err != nil {
+					yield(ServerEvent{}, err)
+					return
+				}
+				retrier = r
+				retrier.Next()
+				streak = true
+			}
+
+			req, err := request.Build(slices.Concat(reqOpts, streamHeaders(last_id))...)
+			if err != nil {
+				yield(ServerEvent{}, err)
+				return
+			}
+
+			http_resp, _, err := c.tracked(ctx, req, n)
+			if ctx.Err() != nil {
+				closeBody(http_resp)
+				return
+			}
+
+			if err == nil {
+				err = checkStream(http_resp)
+			}
+			if errors.Is(err, ErrStreamRejected) {
+				closeBody(http_resp)
+				yield(ServerEvent{}, err)
+				return
+			}
+			if err == nil && http_resp.StatusCode == http.StatusNoContent {
+				closeBody(http_resp)
+				return
+			}
+
+			if err == nil {
+				p := newEventParser(http_resp.Body, last_id, delay)
+				for {
+					ev, read_err := p.next()
+					if read_err != nil {
+						err = read_err
+						break
+					}
+
+					streak = false
+					if !yield(ev, nil) {
+						http_resp.Body.Close()
+						return
+					}
+				}
+				http_resp.Body.Close()
+				last_id, delay = p.last_id, p.retry
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+			if streak {
+				more, ctx_err := retrier.NextContext(ctx)
+				if ctx_err != nil {
+					return
+				}
+				if !more {
+					yield(ServerEvent{}, fmt.Errorf("%w:%v", ErrStreamExhausted, err))
+					return
+				}
+			}
+			if !sleep(ctx, delay) {
+				return
+			}
+		}
+	}
+}
+
+// Events is Stream delivering on a channel, closed once the stream ends.
+func Events(
+	ctx context.Context,
+	c Client,
+	reqOpts []request.RequestOptions,
+	opts ...StreamOptions,
+) <-chan StreamResult {
+	out := make(chan StreamResult)
+	go func() {
+		defer close(out)
+		for ev, err := range Stream(ctx, c, reqOpts, opts...) {
+			select {
+			case out <- StreamResult{ev, err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func streamHeaders(last_id string) []request.RequestOptions {
+	opts := []request.RequestOptions{
+		defaultHeader("Accept", EventStreamContentType),
+		defaultHeader("Cache-Control", "no-store"),
+	}
+	if last_id != "" {
+		opts = append(opts, request.Header(request.SetRequestHeader("Last-Event-ID", last_id)))
+	}
+
+	return opts
+}
+
+// checkStream tells the answers worth a reconnect apart from the rejected
+// ones.
+func checkStream(http_resp *http.Response) error {
+	code := http_resp.StatusCode
+	switch {
+	case code == http.StatusOK:
+		media_type, _, _ := mime.ParseMediaType(http_resp.Header.Get("Content-Type"))
+		if media_type != EventStreamContentType {
+			return fmt.Errorf("%w:content type %q", ErrStreamRejected, media_type)
+		}
+		return nil
+	case code == http.StatusNoContent:
+		return nil
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500:
+		return fmt.Errorf("status %d", code)
+	}
+
+	return fmt.Errorf("%w:status %d", ErrStreamRejected, code)
+}
+
+func closeBody(http_resp *http.Response) {
+	if http_resp != nil {
+		http_resp.Body.Close()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// eventParser reads events as the HTML standard describes, with the last
+// event ID and the reconnection delay carried over from earlier events.
+type eventParser struct {
+	scanner *bufio.Scanner
+	first   bool
+	last_id string
+	retry   time.Duration
+}
+
+// maxEventLine bounds a single line of the stream.
+const maxEventLine = 1 << 20
+
+func newEventParser(r io.Reader, last_id string, retry time.Duration) *eventParser {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventLine)
+	scanner.Split(scanEventLines)
+
+	return &eventParser{scanner, true, last_id, retry}
+}
+
+// next returns the next complete event, io.EOF once the stream ended. An
+// event cut short by the end of the stream is dropped.
+func (p *eventParser) next() (ServerEvent, error) {
+	var ev ServerEvent
+	data := strings.Builder{}
+	has_data := false
+
+	for p.scanner.Scan() {
+		line := p.scanner.Text()
+		if p.first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+			p.first = false
+		}
+
+		if line == "" {
+			if !has_data {
+				ev = ServerEvent{}
+				continue
+			}
+
+			ev.ID = p.last_id
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			return ev, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			has_data = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.last_id = value
+			}
+		case "retry":
+			if value != "" && strings.Trim(value, "0123456789") == "" {
+				ms, err := strconv.Atoi(value)
+				if err == nil {
+					p.retry = time.Duration(ms) * time.Millisecond
+					ev.Retry = p.retry
+				}
+			}
+		}
+	}
+
+	if err := p.scanner.Err(); err != nil {
+		return ServerEvent{}, err
+	}
+	return ServerEvent{}, io.EOF
+}
+
+// scanEventLines splits on CRLF, LF or a lone CR.
+func scanEventLines(data []byte, at_eof bool) (int, []byte, error) {
+	if at_eof && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i < 0 && at_eof:
+		return len(data), data, nil
+	case i < 0:
+		return 0, nil, nil
+	case data[i] == '\n':
+		return i + 1, data[:i], nil
+	case i+1 < len(data) && data[i+1] == '\n':
+		return i + 2, data[:i], nil
+	case i+1 < len(data) || at_eof:
+		return i + 1, data[:i], nil
+	}
+
+	// A CR at the end of the buffer may be followed by a LF.
+	return 0, nil, nil
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+)
+
+var ErrTemplateBaseURL = errors.New("template base url must be absolute")
+
+// Template holds what every call to one upstream shares, so that endpoints
+// only add a method and a path. Endpoint options win over the template:
+//
+//   - the endpoint path is joined under the path of the base URL, unless the
+//     endpoint sets request.Path itself;
+//   - a query parameter or header set by the endpoint replaces the default of
+//     the same name;
+//   - Endpoint.Retry and Endpoint.Timeout replace the template policies, and
+//     a response.OnReject given to Endpoint.Send replaces its reject handlers.
+type Template struct {
+	client  Client
+	domain  string
+	path    string
+	headers []templateHeader
+	query   []request.RequestOptions
+}
+
+type templateHeader struct {
+	key   string
+	value string
+}
+
+type TemplateOptions func(Template) Template
+
+// BaseURL sets the scheme, host and base path of every endpoint, e.g.
+// "https://api.example.com/v2".
+func BaseURL(raw string) TemplateOptions {
+	return func(t Template) Template {
+		t.domain = raw
+		return t
+	}
+}
+
+func DefaultHeader(key, value string) TemplateOptions {
+	return func(t Template) Template {
+		t.headers = append(t.headers[:len(t.headers):len(t.headers)], templateHeader{key, value})
+		return t
+	}
+}
+
+func DefaultQuery(key, value string) TemplateOptions {
+	return func(t Template) Template {
+		t.query = append(t.query[:len(t.query):len(t.query)], request.Query(key, value))
+		return t
+	}
+}
+
+func DefaultRetry(opts ...retry.RetryOptions) TemplateOptions {
+	return func(t Template) Template {
+		t.client.Event.OnClientRequest = OnDoRequest(opts...)
+		return t
+	}
+}
+
+func DefaultTimeout(d time.Duration) TemplateOptions {
+	return func(t Template) Template {
+		t.client = t.client.Timeout(d)
+		return t
+	}
+}
+
+func DefaultReject(fns ...func(response.Response) response.RejectResolver) TemplateOptions {
+	return func(t Template) Template {
+		t.client = t.client.Reject(fns...)
+		return t
+	}
+}
+
+// NewTemplate derives endpoints from c, which keeps its middlewares, auth and
+// other settings. The retry policy defaults to retry.Default.
+func NewTemplate(c Client, opts ...TemplateOptions) (Template, error) {
+	t := Template{client: c}
+	if t.client.Event.OnClientRequest == nil {
+		t.client.Event.OnClientRequest = OnDoRequest(retry.Default()...)
+	}
+	for _, opt := range opts {
+		t = opt(t)
+	}
+
+	u, err := url.Parse(t.domain)
+	if err != nil {
+		return Template{}, fmt.Errorf("%w:%v", ErrTemplateBaseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Template{}, fmt.Errorf("%w:%q", ErrTemplateBaseURL, t.domain)
+	}
+	t.domain = u.Scheme + "://" + u.Host
+	t.path = strings.TrimSuffix(u.EscapedPath(), "/")
+
+	return t, nil
+}
+
+// Endpoint is one call derived from a Template. Send it with Send, Call or
+// CallErr.
+type Endpoint struct {
+	client  Client
+	options []request.RequestOptions
+}
+
+func (t Template) Endpoint(method request.RequestOptions, path string, opts ...request.RequestOptions) Endpoint {
+	options := []request.RequestOptions{
+		request.Domain(t.domain),
+		request.Path(t.path + "/" + strings.TrimPrefix(path, "/")),
+		method,
+	}
+	options = append(options, t.query...)
+	options = append(options, opts...)
+	for _, h := range t.headers {
+		options = append(options, defaultHeader(h.key, h.value))
+	}
+
+	return Endpoint{t.client, options}
+}
+
+func (t Template) Get(path string, opts ...request.RequestOptions) Endpoint {
+	return t.Endpoint(request.Get(), path, opts...)
+}
+
+func (t Template) Post(path string, opts ...request.RequestOptions) Endpoint {
+	return t.Endpoint(request.Post(), path, opts...)
+}
+
+func (t Template) Put(path string, opts ...request.RequestOptions) Endpoint {
+	return t.Endpoint(request.Put(), path, opts...)
+}
+
+func (t Template) Patch(path string, opts ...request.RequestOptions) Endpoint {
+	return t.Endpoint(request.Patch(), path, opts...)
+}
+
+func (t Template) Delete(path string, opts ...request.RequestOptions) Endpoint {
+	return t.Endpoint(request.Delete(), path, opts...)
+}
+
+// defaultHeader adds a header the endpoint did not set. It runs after the
+// endpoint options as request headers accumulate rather than replace.
+func defaultHeader(key, value string) request.RequestOptions {
+	return func(r request.Request) request.Request {
+		if r.GetHeader(key) != "" {
+			return r
+		}
+
+		return request.Header(request.SetRequestHeader(key, value))(r)
+	}
+}
+
+func (e Endpoint) Retry(opts ...retry.RetryOptions) Endpoint {
+	e.client.Event.OnClientRequest = OnDoRequest(opts...)
+	return e
+}
+
+func (e Endpoint) Timeout(d time.Duration) Endpoint {
+	e.client = e.client.Timeout(d)
+	return e
+}
+
+// Client returns the client and the request options of the endpoint, for
+// the calls not covered by Send, Do and DoErr.
+func (e Endpoint) Client() (Client, []request.RequestOptions) {
+	return e.client, e.options
+}
+
+// Send resolves the answer with respOpts on top of the template reject
+// handlers.
+func (e Endpoint) Send(ctx context.Context, respOpts ...response.ResponseFunc) (Result, error) {
+	respOpts = append([]response.ResponseFunc{response.OnReject(e.client.reject...)}, respOpts...)
+	return e.client.Register(
+		BeforeDoRequest(e.options...),
+		e.client.Event.OnClientRequest,
+		AfterDoRequest(respOpts...),
+	).Execute(ctx)
+}
+
+// Call is Do for an endpoint of a template.
+func Call[T any](ctx context.Context, e Endpoint) (T, Result, error) {
+	return Do[T](ctx, e.client, e.options...)
+}
+
+// CallErr is DoErr for an endpoint of a template.
+func CallErr[T, E any](ctx context.Context, e Endpoint) (T, Result, error) {
+	return DoErr[T, E](ctx, e.client, e.options...)
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+)
+
+// StatusError is returned by DoErr when the upstream rejected the request.
+// Body holds the decoded error body, Err the error Send would have returned.
+type StatusError[E any] struct {
+	StatusCode int
+	Body       E
+	Err        error
+}
+
+func (e *StatusError[E]) Error() string {
+	return fmt.Sprintf("%d %s:%v", e.StatusCode, http.StatusText(e.StatusCode), e.Err)
+}
+
+func (e *StatusError[E]) Unwrap() error {
+	return e.Err
+}
+
+// Do sends the request built from reqOpts through c and decodes the answer
+// into a T of its own, so a client can be shared by concurrent calls. The
+// retry policy registered on c is used, else retry.Default. Bodiless
+// answers, to a HEAD or with a 204, leave the zero T.
+func Do[T any](ctx context.Context, c Client, reqOpts ...request.RequestOptions) (T, Result, error) {
+	var v T
+	result, err := c.typed(ctx, reqOpts, &v, response.OnReject(c.reject...))
+	return v, result, err
+}
+
+// DoErr is Do decoding the body of rejected requests into an E, returned in
+// a *StatusError[E].
+func DoErr[T, E any](ctx context.Context, c Client, reqOpts ...request.RequestOptions) (T, Result, error) {
+	var v T
+	var e E
+	reject := slices.Concat(c.reject, []func(response.Response) response.RejectResolver{
+		response.DecodeReject(&e),
+	})
+	result, err := c.typed(ctx, reqOpts, &v, response.OnReject(reject...))
+	if err != nil && result.StatusCode() != 0 && !result.Response.Success() {
+		err = &StatusError[E]{result.StatusCode(), e, err}
+	}
+
+	return v, result, err
+}
+
+func (c Client) typed(
+	ctx context.Context,
+	reqOpts []request.RequestOptions,
+	v any,
+	on_reject response.ResponseFunc,
+) (Result, error) {
+	on_request := c.Event.OnClientRequest
+	if on_request == nil {
+		on_request = OnDoRequest(retry.Default()...)
+	}
+
+	return c.Register(
+		BeforeDoRequest(reqOpts...),
+		on_request,
+		AfterDoRequest(
+			response.OnSuccess(response.DecodeOrFail(v)),
+			on_reject,
+		),
+	).Execute(ctx)
+}
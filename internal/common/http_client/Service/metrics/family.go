@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type kind string
+
+const (
+	counter   kind = "counter"
+	gauge     kind = "gauge"
+	histogram kind = "histogram"
+)
+
+// family is a metric with all of its labelled series. It is guarded by the
+// Registry mutex.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+
+	value float64
+
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newFamily(name, help string, k kind, labels []string, buckets []float64) *family {
+	return &family{
+		name:    name,
+		help:    help,
+		kind:    k,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+}
+
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values), counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+func (f *family) add(values []string, delta float64) {
+	f.get(values).value += delta
+}
+
+func (f *family) observe(values []string, v float64) {
+	s := f.get(values)
+	for i, bound := range f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (f *family) write(b *strings.Builder) {
+	if len(f.series) == 0 {
+		return
+	}
+
+	b.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	b.WriteString("# TYPE " + f.name + " " + string(f.kind) + "\n")
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != histogram {
+			b.WriteString(f.name + f.labelSet(s.values) + " " + formatFloat(s.value) + "\n")
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			b.WriteString(f.name + "_bucket" + f.labelSet(s.values, "le", formatFloat(bound)) + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+		}
+		b.WriteString(f.name + "_bucket" + f.labelSet(s.values, "le", "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+		b.WriteString(f.name + "_sum" + f.labelSet(s.values) + " " + formatFloat(s.sum) + "\n")
+		b.WriteString(f.name + "_count" + f.labelSet(s.values) + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+// labelSet renders {name="value",...}, with extra name/value pairs last.
+func (f *family) labelSet(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+escape(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
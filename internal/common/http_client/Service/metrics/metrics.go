@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+// ContentType is the Prometheus text exposition format served by Handler.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefaultDurationBuckets are the upper bounds, in seconds, of the latency
+	// histogram.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the upper bounds, in bytes, of the body size
+	// histograms.
+	DefaultSizeBuckets = []float64{100, 1_000, 10_000, 100_000, 1_000_000, 10_000_000}
+)
+
+type Config struct {
+	namespace        string
+	duration_buckets []float64
+	size_buckets     []float64
+}
+
+type ConfigOptions func(Config) Config
+
+// Namespace prefixes every metric name, "http_client" by default.
+func Namespace(ns string) ConfigOptions {
+	return func(c Config) Config {
+		c.namespace = ns
+		return c
+	}
+}
+
+func DurationBuckets(buckets ...float64) ConfigOptions {
+	return func(c Config) Config {
+		c.duration_buckets = buckets
+		return c
+	}
+}
+
+func SizeBuckets(buckets ...float64) ConfigOptions {
+	return func(c Config) Config {
+		c.size_buckets = buckets
+		return c
+	}
+}
+
+// Registry records upstream calls made through its Middleware and exposes
+// them on Handler.
+type Registry struct {
+	mu sync.Mutex
+
+	requests  *family
+	duration  *family
+	in_flight *family
+	retries   *family
+	req_size  *family
+	resp_size *family
+}
+
+func New(opts ...ConfigOptions) *Registry {
+	cfg := Config{
+		namespace:        "http_client",
+		duration_buckets: DefaultDurationBuckets,
+		size_buckets:     DefaultSizeBuckets,
+	}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	name := func(s string) string {
+		if cfg.namespace == "" {
+			return s
+		}
+		return cfg.namespace + "_" + s
+	}
+	call := []string{"client", "method", "host"}
+	outcome := []string{"client", "method", "host", "status_class"}
+
+	return &Registry{
+		requests:  newFamily(name("requests_total"), "Upstream calls made.", counter, outcome, nil),
+		duration:  newFamily(name("request_duration_seconds"), "Time until the upstream answered with headers.", histogram, outcome, cfg.duration_buckets),
+		in_flight: newFamily(name("in_flight_requests"), "Upstream calls waiting for an answer.", gauge, call, nil),
+		retries:   newFamily(name("retries_total"), "Upstream calls that were a retry of a previous attempt.", counter, call, nil),
+		req_size:  newFamily(name("request_size_bytes"), "Size of the request bodies sent.", histogram, call, cfg.size_buckets),
+		resp_size: newFamily(name("response_size_bytes"), "Size of the response bodies read.", histogram, outcome, cfg.size_buckets),
+	}
+}
+
+// statusClass groups status codes as "2xx", "4xx" and so on. Exchanges
+// without an answer are "error".
+func statusClass(resp *http.Response, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode/100) + "xx"
+}
+
+func (r *Registry) Middleware() client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			info, _ := client.AttemptFromContext(req.Context())
+			call := []string{info.Client, req.Method, req.URL.Host}
+
+			r.mu.Lock()
+			r.in_flight.add(call, 1)
+			if info.Attempt > 1 {
+				r.retries.add(call, 1)
+			}
+			r.req_size.observe(call, float64(max(req.ContentLength, 0)))
+			r.mu.Unlock()
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			elapsed := time.Since(start)
+
+			outcome := []string{info.Client, req.Method, req.URL.Host, statusClass(resp, err)}
+			r.mu.Lock()
+			r.in_flight.add(call, -1)
+			r.requests.add(outcome, 1)
+			r.duration.observe(outcome, elapsed.Seconds())
+			r.mu.Unlock()
+
+			if err != nil {
+				return nil, err
+			}
+
+			resp.Body = &countedBody{ReadCloser: resp.Body, done: func(n int64) {
+				r.mu.Lock()
+				r.resp_size.observe(outcome, float64(n))
+				r.mu.Unlock()
+			}}
+			return resp, nil
+		})
+	}
+}
+
+// Handler serves every metric in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := &strings.Builder{}
+	for _, f := range []*family{r.requests, r.duration, r.in_flight, r.retries, r.req_size, r.resp_size} {
+		f.write(b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// countedBody reports the number of bytes read once the body is closed.
+type countedBody struct {
+	io.ReadCloser
+	done func(n int64)
+
+	read int64
+	once sync.Once
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *countedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.read) })
+	return err
+}
@@ -0,0 +1,110 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("Scrape counts, latency, retries and sizes", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/rates", func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("rates"))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		registry := metrics.New(metrics.DurationBuckets(1, 5), metrics.SizeBuckets(4, 1000))
+
+		var data string
+		err := client.New("Rates").
+			Use(registry.Middleware()).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/rates"),
+				),
+				client.OnDoRequest(retry.Simple(2, 0, func(code int) bool { return code == http.StatusOK })...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+
+		call := `client="Rates",method="GET",host="` + host + `"`
+		body := rec.Body.String()
+		for _, line := range []string{
+			"# TYPE http_client_requests_total counter",
+			`http_client_requests_total{` + call + `,status_class="2xx"} 1`,
+			`http_client_requests_total{` + call + `,status_class="5xx"} 1`,
+			"# TYPE http_client_request_duration_seconds histogram",
+			`http_client_request_duration_seconds_bucket{` + call + `,status_class="2xx",le="+Inf"} 1`,
+			`http_client_request_duration_seconds_count{` + call + `,status_class="2xx"} 1`,
+			`http_client_in_flight_requests{` + call + `} 0`,
+			`http_client_retries_total{` + call + `} 1`,
+			`http_client_request_size_bytes_count{` + call + `} 2`,
+			`http_client_response_size_bytes_bucket{` + call + `,status_class="2xx",le="4"} 0`,
+			`http_client_response_size_bytes_bucket{` + call + `,status_class="2xx",le="1000"} 1`,
+			`http_client_response_size_bytes_sum{` + call + `,status_class="2xx"} 5`,
+		} {
+			assert.Contains(t, body, line+"\n")
+		}
+	})
+
+	t.Run("Failed exchanges are counted as errors", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		u, _ := url.Parse(server.URL)
+
+		registry := metrics.New(metrics.Namespace("upstream"))
+		var data string
+		err := client.New("Down").
+			Use(registry.Middleware()).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/rates"),
+				),
+				client.OnDoRequest(retry.Default()...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+				),
+			).Send()
+		require.Error(t, err)
+
+		body := &strings.Builder{}
+		registry.WriteTo(body)
+		assert.Contains(t, body.String(),
+			`upstream_requests_total{client="Down",method="GET",host="`+u.Host+`",status_class="error"} 1`)
+		assert.NotContains(t, body.String(), "upstream_response_size_bytes")
+	})
+}
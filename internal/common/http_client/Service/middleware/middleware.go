@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/redact"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+// Header sets key to value on every outgoing request.
+func Header(key, value string) client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(key, value)
+			return next.Do(req)
+		})
+	}
+}
+
+func UserAgent(agent string) client.Middleware {
+	return Header("User-Agent", agent)
+}
+
+func BearerToken(token string) client.Middleware {
+	return Header("Authorization", "Bearer "+token)
+}
+
+func BasicAuth(username, password string) client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req.SetBasicAuth(username, password)
+			return next.Do(req)
+		})
+	}
+}
+
+type propagateKey struct{}
+
+// WithPropagatedHeaders stores h on the context so that PropagateHeaders can
+// forward selected inbound headers to the upstream calls made with ctx.
+func WithPropagatedHeaders(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, propagateKey{}, h.Clone())
+}
+
+// PropagateHeaders copies keys from the headers stored by
+// WithPropagatedHeaders onto every outgoing request. Headers already set on
+// the request are left alone.
+func PropagateHeaders(keys ...string) client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			inbound, ok := req.Context().Value(propagateKey{}).(http.Header)
+			if !ok {
+				return next.Do(req)
+			}
+
+			for _, key := range keys {
+				if req.Header.Get(key) != "" {
+					continue
+				}
+				for _, value := range inbound.Values(key) {
+					req.Header.Add(key, value)
+				}
+			}
+
+			return next.Do(req)
+		})
+	}
+}
+
+// ObserveFunc receives the outcome of a single exchange. resp is nil when
+// err is not.
+type ObserveFunc func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+
+// Observe calls fn after every exchange, which is enough to feed counters or
+// latency histograms.
+func Observe(fn ObserveFunc) client.Middleware {
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			fn(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Logger writes one line per exchange to l, masked by the default redaction
+// policy.
+func Logger(l *log.Logger) client.Middleware {
+	return Observe(func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+		p := redact.Default()
+		if err != nil {
+			l.Printf("%s %s failed after %s: %s", req.Method, p.URL(req.URL.String()), elapsed, p.Text(err.Error()))
+			return
+		}
+		l.Printf("%s %s %d %s", req.Method, p.URL(req.URL.String()), resp.StatusCode, elapsed)
+	})
+}
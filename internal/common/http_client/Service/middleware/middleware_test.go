@@ -0,0 +1,214 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoHeaders(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"authorization":"` + r.Header.Get("Authorization") +
+			`","user_agent":"` + r.Header.Get("User-Agent") +
+			`","request_id":"` + r.Header.Get("X-Request-Id") + `"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+type echo struct {
+	Authorization string `json:"authorization"`
+	UserAgent     string `json:"user_agent"`
+	RequestId     string `json:"request_id"`
+}
+
+func send(ctx context.Context, server *httptest.Server, mws ...client.Middleware) (echo, error) {
+	var data echo
+	err := client.New("Echo").
+		Use(mws...).
+		Register(
+			client.BeforeDoRequest(
+				request.Get(),
+				request.Domain(server.URL),
+				request.Path("/api/v1/echo"),
+			),
+			client.OnDoRequest(retry.Default()...),
+			client.AfterDoRequest(
+				response.OnSuccess(
+					response.Decode(&data),
+				),
+				response.OnReject(),
+			),
+		).SendContext(ctx)
+
+	return data, err
+}
+
+func TestBuiltinMiddlewares(t *testing.T) {
+	t.Run("Bearer token and user agent", func(t *testing.T) {
+		server := echoHeaders(t)
+
+		data, err := send(
+			context.Background(),
+			server,
+			middleware.BearerToken("secret"),
+			middleware.UserAgent("api-agg/2"),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer secret", data.Authorization)
+		assert.Equal(t, "api-agg/2", data.UserAgent)
+	})
+
+	t.Run("Propagate inbound headers from context", func(t *testing.T) {
+		server := echoHeaders(t)
+
+		inbound := http.Header{}
+		inbound.Set("X-Request-Id", "req-123")
+		inbound.Set("Cookie", "must-not-leak")
+		ctx := middleware.WithPropagatedHeaders(context.Background(), inbound)
+
+		data, err := send(ctx, server, middleware.PropagateHeaders("X-Request-Id"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "req-123", data.RequestId)
+	})
+
+	t.Run("Logger writes one line per exchange", func(t *testing.T) {
+		server := echoHeaders(t)
+
+		buf := &bytes.Buffer{}
+		_, err := send(context.Background(), server, middleware.Logger(log.New(buf, "", 0)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+		assert.Contains(t, buf.String(), "GET "+server.URL+"/api/v1/echo 200")
+	})
+
+	t.Run("Observe receives status and duration", func(t *testing.T) {
+		server := echoHeaders(t)
+
+		var code int
+		var elapsed time.Duration
+		_, err := send(context.Background(), server, middleware.Observe(
+			func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+				code = resp.StatusCode
+				elapsed = d
+			},
+		))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Greater(t, elapsed, time.Duration(0))
+	})
+}
+
+func TestSlog(t *testing.T) {
+	records := func(t *testing.T, buf *bytes.Buffer) []map[string]any {
+		var out []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			record := map[string]any{}
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			out = append(out, record)
+		}
+		return out
+	}
+
+	t.Run("One record per attempt", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/v1/flaky", func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`"accepted by the upstream"`))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+		var data string
+		err := client.New("Flaky").
+			RetryNonIdempotent().
+			Use(middleware.Slog(logger, middleware.LogRequestBody(8), middleware.LogResponseBody(9))).
+			Register(
+				client.BeforeDoRequest(
+					request.Post(),
+					request.Domain(server.URL),
+					request.Path("/api/v1/flaky"),
+					request.Json(struct {
+						Name string `json:"name"`
+					}{"value"}),
+				),
+				client.OnDoRequest(retry.Simple(2, 0, func(code int) bool { return code == http.StatusOK })...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+		require.NoError(t, err)
+
+		logged := records(t, buf)
+		require.Len(t, logged, 2)
+
+		assert.Equal(t, "ERROR", logged[0]["level"])
+		assert.Equal(t, "Flaky", logged[0]["client"])
+		assert.EqualValues(t, 1, logged[0]["attempt"])
+		assert.EqualValues(t, http.StatusServiceUnavailable, logged[0]["status"])
+		assert.Equal(t, "server_error", logged[0]["error_class"])
+		assert.Equal(t, `{"name":`, logged[0]["request_body"])
+
+		assert.Equal(t, "INFO", logged[1]["level"])
+		assert.EqualValues(t, 2, logged[1]["attempt"])
+		assert.Equal(t, "POST", logged[1]["method"])
+		assert.Equal(t, server.URL+"/api/v1/flaky", logged[1]["url"])
+		assert.EqualValues(t, 16, logged[1]["bytes_out"])
+		assert.EqualValues(t, 26, logged[1]["bytes_in"])
+		assert.Equal(t, `"accepted`, logged[1]["response_body"])
+		assert.NotContains(t, logged[1], "error_class")
+	})
+
+	t.Run("Failed exchanges carry an error class", func(t *testing.T) {
+		server := echoHeaders(t)
+		server.Close()
+
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, nil))
+		_, err := send(context.Background(), server, middleware.Slog(logger,
+			middleware.Levels(slog.LevelDebug, slog.LevelInfo, slog.LevelInfo, slog.LevelWarn),
+		))
+		require.Error(t, err)
+
+		logged := records(t, buf)
+		require.Len(t, logged, 1)
+		assert.Equal(t, "WARN", logged[0]["level"])
+		assert.Equal(t, "connection", logged[0]["error_class"])
+	})
+}
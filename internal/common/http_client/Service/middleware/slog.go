@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/redact"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+)
+
+type SlogConfig struct {
+	success      slog.Level
+	client_error slog.Level
+	server_error slog.Level
+	failure      slog.Level
+
+	request_body  int
+	response_body int
+
+	policy *redact.Policy
+}
+
+type SlogOptions func(SlogConfig) SlogConfig
+
+// Levels sets the record level for 1xx-3xx answers, 4xx, 5xx and exchanges
+// that failed without an answer. The defaults are Info, Warn, Error and Error.
+func Levels(success, client_error, server_error, failure slog.Level) SlogOptions {
+	return func(c SlogConfig) SlogConfig {
+		c.success = success
+		c.client_error = client_error
+		c.server_error = server_error
+		c.failure = failure
+		return c
+	}
+}
+
+// LogRequestBody adds up to limit bytes of the request body to the record.
+func LogRequestBody(limit int) SlogOptions {
+	return func(c SlogConfig) SlogConfig {
+		c.request_body = limit
+		return c
+	}
+}
+
+// LogResponseBody adds up to limit bytes of the response body to the record.
+func LogResponseBody(limit int) SlogOptions {
+	return func(c SlogConfig) SlogConfig {
+		c.response_body = limit
+		return c
+	}
+}
+
+// Redact masks URLs, bodies and errors with p instead of the default
+// redaction policy.
+func Redact(p redact.Policy) SlogOptions {
+	return func(c SlogConfig) SlogConfig {
+		c.policy = &p
+		return c
+	}
+}
+
+func (c SlogConfig) redaction() redact.Policy {
+	if c.policy != nil {
+		return *c.policy
+	}
+	return redact.Default()
+}
+
+// Slog writes one structured record per exchange to l. Records of answered
+// exchanges are written once the response body is closed, so that they carry
+// the number of bytes read.
+func Slog(l *slog.Logger, opts ...SlogOptions) client.Middleware {
+	cfg := SlogConfig{
+		success:      slog.LevelInfo,
+		client_error: slog.LevelWarn,
+		server_error: slog.LevelError,
+		failure:      slog.LevelError,
+	}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return func(next client.Doer) client.Doer {
+		return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			p := cfg.redaction()
+			attrs := []slog.Attr{}
+			if info, ok := client.AttemptFromContext(req.Context()); ok {
+				attrs = append(attrs,
+					slog.String("client", info.Client),
+					slog.Int("attempt", info.Attempt),
+				)
+			}
+			attrs = append(attrs,
+				slog.String("method", req.Method),
+				slog.String("url", p.URL(req.URL.String())),
+				slog.Int64("bytes_out", max(req.ContentLength, 0)),
+			)
+			if cfg.request_body > 0 {
+				attrs = append(attrs, slog.String("request_body", string(p.JSON(peekBody(req, cfg.request_body)))))
+			}
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			elapsed := time.Since(start)
+			if err != nil {
+				attrs = append(attrs,
+					slog.Duration("duration", elapsed),
+					slog.String("error_class", errorClass(err)),
+					slog.String("error", p.Text(err.Error())),
+				)
+				l.LogAttrs(req.Context(), cfg.failure, "upstream call failed", attrs...)
+				return nil, err
+			}
+
+			level := cfg.success
+			attrs = append(attrs,
+				slog.Int("status", resp.StatusCode),
+				slog.Duration("duration", elapsed),
+			)
+			switch {
+			case resp.StatusCode >= http.StatusInternalServerError:
+				level = cfg.server_error
+				attrs = append(attrs, slog.String("error_class", "server_error"))
+			case resp.StatusCode >= http.StatusBadRequest:
+				level = cfg.client_error
+				attrs = append(attrs, slog.String("error_class", "client_error"))
+			}
+
+			resp.Body = &loggedBody{
+				ReadCloser: resp.Body,
+				limit:      cfg.response_body,
+				emit: func(bytes_in int64, body []byte, read_err error) {
+					attrs := append(attrs, slog.Int64("bytes_in", bytes_in))
+					if cfg.response_body > 0 {
+						attrs = append(attrs, slog.String("response_body", string(p.JSON(body))))
+					}
+					if read_err != nil {
+						attrs = append(attrs, slog.String("error", read_err.Error()))
+					}
+					l.LogAttrs(context.WithoutCancel(req.Context()), level, "upstream call", attrs...)
+				},
+			}
+			return resp, nil
+		})
+	}
+}
+
+// peekBody reads up to limit bytes from a fresh copy of the request body.
+func peekBody(req *http.Request, limit int) []byte {
+	if req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(body, int64(limit)))
+	return b
+}
+
+// loggedBody counts the bytes read, keeps the first limit of them and emits
+// the record on Close.
+type loggedBody struct {
+	io.ReadCloser
+	limit int
+	emit  func(bytes_in int64, body []byte, err error)
+
+	read     int64
+	kept     bytes.Buffer
+	read_err error
+	once     sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if room := b.limit - b.kept.Len(); room > 0 {
+		b.kept.Write(p[:min(n, room)])
+	}
+	if err != nil && err != io.EOF {
+		b.read_err = err
+	}
+
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.emit(b.read, b.kept.Bytes(), b.read_err)
+	})
+
+	return err
+}
+
+// errorClass sorts exchange errors into a few stable values fit for
+// filtering and alerting.
+func errorClass(err error) string {
+	var (
+		dns_err  *net.DNSError
+		op_err   *net.OpError
+		net_err  net.Error
+		cert_err *tls.CertificateVerificationError
+		unknown  x509.UnknownAuthorityError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &net_err) && net_err.Timeout():
+		return "timeout"
+	case errors.As(err, &dns_err):
+		return "dns"
+	case errors.As(err, &cert_err), errors.As(err, &unknown):
+		return "tls"
+	case errors.As(err, &op_err):
+		return "connection"
+	}
+
+	return "other"
+}
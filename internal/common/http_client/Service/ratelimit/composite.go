@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrEmptyComposite = errors.New("composite limiter needs at least one limiter")
+
+// releaser is implemented by the limiters of this package, which can hand
+// back a permit a composite took but could not use.
+type releaser interface {
+	release()
+}
+
+// Composite takes a permit from each of its limiters, e.g. 50 per second and
+// 10000 per day on the same upstream. Permits taken before another limiter
+// refused are handed back, except by limiters from outside this package.
+type Composite struct {
+	limiters []Limiter
+	counters counters
+}
+
+func NewComposite(limiters ...Limiter) (*Composite, error) {
+	if len(limiters) == 0 {
+		return nil, ErrEmptyComposite
+	}
+
+	return &Composite{limiters: limiters}, nil
+}
+
+func (c *Composite) Allow() bool {
+	for i, l := range c.limiters {
+		if !l.Allow() {
+			release(c.limiters[:i])
+			c.counters.rejected()
+			return false
+		}
+	}
+
+	c.counters.allowed(0)
+	return true
+}
+
+// Wait waits on the limiters in order, so the one with the longest window is
+// best given first: the others are not held while it is exhausted.
+func (c *Composite) Wait(ctx context.Context) error {
+	var waited time.Duration
+	for i, l := range c.limiters {
+		start := time.Now()
+		if err := l.Wait(ctx); err != nil {
+			release(c.limiters[:i])
+			c.counters.rejected()
+			return err
+		}
+		waited += time.Since(start)
+	}
+
+	c.counters.allowed(waited)
+	return nil
+}
+
+// Stats counts the permits of the composite, each limiter keeps its own.
+func (c *Composite) Stats() Stats {
+	return c.counters.snapshot()
+}
+
+func release(limiters []Limiter) {
+	for _, l := range limiters {
+		if r, ok := l.(releaser); ok {
+			r.release()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited   = errors.New("rate limit exceeded")
+	ErrInvalidLimit  = errors.New("rate limit has to be positive")
+	ErrInvalidWindow = errors.New("rate limit window has to be positive")
+)
+
+type Limiter interface {
+	// Allow takes a permit if one is available right now.
+	Allow() bool
+	// Wait blocks until a permit is available or ctx is done.
+	Wait(ctx context.Context) error
+	Stats() Stats
+}
+
+type Stats struct {
+	Allowed  uint64
+	Rejected uint64
+	// Waited counts permits that were not immediately available.
+	Waited   uint64
+	WaitTime time.Duration
+}
+
+type counters struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func (c *counters) allowed(waited time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Allowed++
+	if waited > 0 {
+		c.stats.Waited++
+		c.stats.WaitTime += waited
+	}
+}
+
+// undo forgets a permit that was handed back.
+func (c *counters) undo() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Allowed--
+}
+
+func (c *counters) rejected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Rejected++
+}
+
+func (c *counters) snapshot() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// exceedsDeadline reports whether ctx expires before d elapsed, in which case
+// waiting is pointless.
+func exceedsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < d
+}
+
+type Mode int
+
+const (
+	// Wait blocks the attempt until a permit is available.
+	Wait Mode = iota
+	// Reject fails the attempt with ErrRateLimited right away.
+	Reject
+)
+
+// KeyFunc picks the limiter of a call from the client name and the upstream
+// domain.
+type KeyFunc func(name, domain string) string
+
+func ByDomain(name, domain string) string {
+	return domain
+}
+
+func ByName(name, domain string) string {
+	return name
+}
+
+// Registry shares one limiter per key between every client using it, so that
+// all clients calling the same domain draw from the same quota. A factory
+// returning a Composite enforces several quotas on one key.
+type Registry struct {
+	key     KeyFunc
+	mode    Mode
+	factory func() Limiter
+
+	mu       sync.Mutex
+	limiters map[string]Limiter
+}
+
+func NewRegistry(key KeyFunc, mode Mode, factory func() Limiter) *Registry {
+	return &Registry{
+		key:      key,
+		mode:     mode,
+		factory:  factory,
+		limiters: map[string]Limiter{},
+	}
+}
+
+func (r *Registry) Get(name, domain string) Limiter {
+	key := r.key(name, domain)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.limiters[key]
+	if !ok {
+		l = r.factory()
+		r.limiters[key] = l
+	}
+
+	return l
+}
+
+// Take obtains a permit for a call according to the registry mode.
+func (r *Registry) Take(ctx context.Context, name, domain string) error {
+	l := r.Get(name, domain)
+	if r.mode == Reject {
+		if !l.Allow() {
+			return fmt.Errorf("%w:%s", ErrRateLimited, r.key(name, domain))
+		}
+		return nil
+	}
+
+	if err := l.Wait(ctx); err != nil {
+		return fmt.Errorf("%w:%w", ErrRateLimited, err)
+	}
+	return nil
+}
+
+// Stats returns the stats of every limiter by key.
+func (r *Registry) Stats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]Stats, len(r.limiters))
+	for key, l := range r.limiters {
+		stats[key] = l.Stats()
+	}
+
+	return stats
+}
@@ -0,0 +1,225 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("Burst then reject", func(t *testing.T) {
+		b, err := ratelimit.NewTokenBucket(1, time.Hour, 3)
+		require.NoError(t, err)
+
+		for range 3 {
+			assert.True(t, b.Allow())
+		}
+		assert.False(t, b.Allow())
+		assert.Equal(t, ratelimit.Stats{Allowed: 3, Rejected: 1}, b.Stats())
+	})
+
+	t.Run("Wait for refill", func(t *testing.T) {
+		b, err := ratelimit.NewTokenBucket(50, time.Second, 1)
+		require.NoError(t, err)
+
+		start := time.Now()
+		for range 3 {
+			require.NoError(t, b.Wait(context.Background()))
+		}
+
+		assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+		assert.EqualValues(t, 2, b.Stats().Waited)
+	})
+
+	t.Run("Wait gives up when the deadline comes first", func(t *testing.T) {
+		b, err := ratelimit.NewTokenBucket(1, time.Hour, 1)
+		require.NoError(t, err)
+		require.True(t, b.Allow())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		assert.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Millisecond, "does not sleep for nothing")
+	})
+
+	t.Run("Invalid limits", func(t *testing.T) {
+		_, err := ratelimit.NewTokenBucket(0, time.Second, 1)
+		assert.ErrorIs(t, err, ratelimit.ErrInvalidLimit)
+
+		_, err = ratelimit.NewTokenBucket(1, 0, 1)
+		assert.ErrorIs(t, err, ratelimit.ErrInvalidWindow)
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Run("Limit per window", func(t *testing.T) {
+		w, err := ratelimit.NewSlidingWindow(5, time.Hour)
+		require.NoError(t, err)
+
+		for range 5 {
+			assert.True(t, w.Allow())
+		}
+		assert.False(t, w.Allow())
+	})
+
+	t.Run("Wait until the window slides", func(t *testing.T) {
+		w, err := ratelimit.NewSlidingWindow(2, 40*time.Millisecond)
+		require.NoError(t, err)
+
+		start := time.Now()
+		for range 4 {
+			require.NoError(t, w.Wait(context.Background()))
+		}
+
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("Wait respects cancellation", func(t *testing.T) {
+		w, err := ratelimit.NewSlidingWindow(1, time.Hour)
+		require.NoError(t, err)
+		require.True(t, w.Allow())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, w.Wait(ctx), context.Canceled)
+		assert.EqualValues(t, 1, w.Stats().Rejected)
+	})
+}
+
+func TestComposite(t *testing.T) {
+	t.Run("Every limiter has to allow", func(t *testing.T) {
+		per_second, err := ratelimit.NewTokenBucket(50, time.Second, 5)
+		require.NoError(t, err)
+		per_day, err := ratelimit.NewSlidingWindow(2, 24*time.Hour)
+		require.NoError(t, err)
+		c, err := ratelimit.NewComposite(per_day, per_second)
+		require.NoError(t, err)
+
+		assert.True(t, c.Allow())
+		assert.True(t, c.Allow())
+		assert.False(t, c.Allow())
+
+		assert.Equal(t, ratelimit.Stats{Allowed: 2, Rejected: 1}, c.Stats())
+		assert.EqualValues(t, 2, per_second.Stats().Allowed)
+	})
+
+	t.Run("Permits are handed back when a later limiter refuses", func(t *testing.T) {
+		bucket, err := ratelimit.NewTokenBucket(1, time.Hour, 1)
+		require.NoError(t, err)
+		window, err := ratelimit.NewSlidingWindow(1, time.Hour)
+		require.NoError(t, err)
+		require.True(t, window.Allow())
+		c, err := ratelimit.NewComposite(bucket, window)
+		require.NoError(t, err)
+
+		assert.False(t, c.Allow())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, c.Wait(ctx), context.DeadlineExceeded)
+
+		assert.True(t, bucket.Allow(), "the bucket permit was not used")
+	})
+
+	t.Run("Wait takes from every limiter", func(t *testing.T) {
+		bucket, err := ratelimit.NewTokenBucket(1, 20*time.Millisecond, 1)
+		require.NoError(t, err)
+		window, err := ratelimit.NewSlidingWindow(10, time.Hour)
+		require.NoError(t, err)
+		c, err := ratelimit.NewComposite(window, bucket)
+		require.NoError(t, err)
+
+		start := time.Now()
+		for range 3 {
+			require.NoError(t, c.Wait(context.Background()))
+		}
+
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+		assert.EqualValues(t, 3, window.Stats().Allowed)
+	})
+
+	t.Run("Empty composite", func(t *testing.T) {
+		_, err := ratelimit.NewComposite()
+		assert.ErrorIs(t, err, ratelimit.ErrEmptyComposite)
+	})
+}
+
+func TestClientRateLimit(t *testing.T) {
+	t.Run("Clients of the same domain share one quota", func(t *testing.T) {
+		var hits atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/rates", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Write([]byte("ok"))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		registry := ratelimit.NewRegistry(ratelimit.ByDomain, ratelimit.Reject, func() ratelimit.Limiter {
+			l, _ := ratelimit.NewTokenBucket(1, time.Hour, 2)
+			return l
+		})
+
+		send := func(name string) error {
+			var data string
+			return client.New(name).
+				RateLimit(registry).
+				Register(
+					client.BeforeDoRequest(
+						request.Get(),
+						request.Domain(server.URL),
+						request.Path("/api/v1/rates"),
+					),
+					client.OnDoRequest(retry.Default()...),
+					client.AfterDoRequest(
+						response.OnSuccess(
+							response.Decode(&data),
+						),
+						response.OnReject(),
+					),
+				).Send()
+		}
+
+		assert.NoError(t, send("RatesA"))
+		assert.NoError(t, send("RatesB"))
+		assert.ErrorIs(t, send("RatesA"), ratelimit.ErrRateLimited)
+
+		assert.EqualValues(t, 2, hits.Load())
+		assert.Equal(t, map[string]ratelimit.Stats{
+			server.URL: {Allowed: 2, Rejected: 1},
+		}, registry.Stats())
+	})
+
+	t.Run("A wait cut short keeps the context error", func(t *testing.T) {
+		registry := ratelimit.NewRegistry(ratelimit.ByDomain, ratelimit.Wait, func() ratelimit.Limiter {
+			l, _ := ratelimit.NewTokenBucket(1, time.Hour, 1)
+			return l
+		})
+		require.NoError(t, registry.Take(context.Background(), "Rates", "example.com"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := registry.Take(ctx, "Rates", "example.com")
+		assert.ErrorIs(t, err, ratelimit.ErrRateLimited)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = registry.Take(ctx, "Rates", "example.com")
+		assert.ErrorIs(t, err, ratelimit.ErrRateLimited)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SlidingWindow allows limit permits per window. The count of the previous
+// fixed window is weighted by how much of it still overlaps the sliding one,
+// which keeps memory constant even for daily quotas.
+type SlidingWindow struct {
+	limit  float64
+	window time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	current  float64
+	previous float64
+	counters counters
+}
+
+func NewSlidingWindow(limit int, window time.Duration) (*SlidingWindow, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	if window <= 0 {
+		return nil, ErrInvalidWindow
+	}
+
+	return &SlidingWindow{
+		limit:  float64(limit),
+		window: window,
+		start:  time.Now(),
+	}, nil
+}
+
+func (w *SlidingWindow) advance(now time.Time) {
+	elapsed := now.Sub(w.start)
+	if elapsed < w.window {
+		return
+	}
+
+	if elapsed < 2*w.window {
+		w.previous = w.current
+	} else {
+		w.previous = 0
+	}
+	w.current = 0
+	w.start = w.start.Add(elapsed / w.window * w.window)
+}
+
+// reserve takes a permit when available, otherwise it returns how long to
+// wait before trying again.
+func (w *SlidingWindow) reserve(now time.Time) (bool, time.Duration) {
+	w.advance(now)
+
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(w.window)
+	if w.previous*weight+w.current+1 <= w.limit {
+		w.current++
+		return true, 0
+	}
+
+	next_window := w.window - elapsed
+	if w.current+1 > w.limit || w.previous == 0 {
+		return false, next_window
+	}
+
+	// Solve previous*(1-(elapsed+d)/window) + current + 1 <= limit for d.
+	d := time.Duration(float64(w.window)*(1-(w.limit-w.current-1)/w.previous)) - elapsed
+	if d <= 0 || d > next_window {
+		d = next_window
+	}
+
+	return false, d
+}
+
+func (w *SlidingWindow) Allow() bool {
+	w.mu.Lock()
+	ok, _ := w.reserve(time.Now())
+	w.mu.Unlock()
+
+	if !ok {
+		w.counters.rejected()
+		return false
+	}
+	w.counters.allowed(0)
+	return true
+}
+
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	var waited time.Duration
+	for {
+		w.mu.Lock()
+		ok, d := w.reserve(time.Now())
+		w.mu.Unlock()
+
+		if ok {
+			w.counters.allowed(waited)
+			return nil
+		}
+
+		if exceedsDeadline(ctx, d) {
+			w.counters.rejected()
+			return context.DeadlineExceeded
+		}
+		if err := sleep(ctx, d); err != nil {
+			w.counters.rejected()
+			return err
+		}
+		waited += d
+	}
+}
+
+// release gives back a permit of the current window, if it did not move on.
+func (w *SlidingWindow) release() {
+	w.mu.Lock()
+	w.advance(time.Now())
+	if w.current > 0 {
+		w.current--
+	}
+	w.mu.Unlock()
+
+	w.counters.undo()
+}
+
+func (w *SlidingWindow) Stats() Stats {
+	return w.counters.snapshot()
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket refills limit permits every per, allowing bursts of up to burst
+// permits.
+type TokenBucket struct {
+	rate  float64 // permits per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	counters counters
+}
+
+func NewTokenBucket(limit int, per time.Duration, burst int) (*TokenBucket, error) {
+	if limit <= 0 || burst <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	if per <= 0 {
+		return nil, ErrInvalidWindow
+	}
+
+	return &TokenBucket{
+		rate:   float64(limit) / per.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}, nil
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	b.refill(time.Now())
+	ok := b.tokens >= 1
+	if ok {
+		b.tokens--
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		b.counters.rejected()
+		return false
+	}
+	b.counters.allowed(0)
+	return true
+}
+
+// Wait reserves a permit up front so that waiters are served in order, and
+// hands it back when ctx ends before the permit is due.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	b.refill(time.Now())
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if exceedsDeadline(ctx, wait) {
+		b.cancel()
+		return context.DeadlineExceeded
+	}
+
+	if err := sleep(ctx, wait); err != nil {
+		b.cancel()
+		return err
+	}
+
+	b.counters.allowed(wait)
+	return nil
+}
+
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+
+	b.counters.rejected()
+}
+
+func (b *TokenBucket) release() {
+	b.mu.Lock()
+	b.tokens = min(b.tokens+1, b.burst)
+	b.mu.Unlock()
+
+	b.counters.undo()
+}
+
+func (b *TokenBucket) Stats() Stats {
+	return b.counters.snapshot()
+}
@@ -0,0 +1,97 @@
+package signer
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+type HMACConfig struct {
+	key_id           string
+	key_id_header    string
+	timestamp_header string
+	signature_header string
+	clock            Clock
+}
+
+type HMACOptions func(HMACConfig) HMACConfig
+
+// KeyId is sent in the key id header so the upstream can pick the secret.
+func KeyId(id string) HMACOptions {
+	return func(c HMACConfig) HMACConfig {
+		c.key_id = id
+		return c
+	}
+}
+
+func HMACHeaders(key_id, timestamp, signature string) HMACOptions {
+	return func(c HMACConfig) HMACConfig {
+		c.key_id_header = key_id
+		c.timestamp_header = timestamp
+		c.signature_header = signature
+		return c
+	}
+}
+
+func HMACClock(clock Clock) HMACOptions {
+	return func(c HMACConfig) HMACConfig {
+		c.clock = clock
+		return c
+	}
+}
+
+// HMAC signs requests with HMAC-SHA256 over the string
+//
+//	METHOD \n PATH \n SORTED_QUERY \n UNIX_TIMESTAMP \n HEX(SHA256(BODY))
+//
+// and sends the hex signature and the timestamp as headers.
+type HMAC struct {
+	secret []byte
+	config HMACConfig
+}
+
+func NewHMAC(secret []byte, opts ...HMACOptions) (HMAC, error) {
+	if len(secret) == 0 {
+		return HMAC{}, ErrMissingSecret
+	}
+
+	cfg := HMACConfig{
+		key_id_header:    "X-Key-Id",
+		timestamp_header: "X-Timestamp",
+		signature_header: "X-Signature",
+		clock:            time.Now,
+	}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return HMAC{secret: secret, config: cfg}, nil
+}
+
+// StringToSign exposes the signed string, mostly for upstream-side
+// verification and debugging.
+func (s HMAC) StringToSign(req request.Request, http_req *http.Request, timestamp string) string {
+	return strings.Join([]string{
+		http_req.Method,
+		canonicalPath(http_req.URL),
+		canonicalQuery(http_req.URL),
+		timestamp,
+		hashHex([]byte(req.GetBody())),
+	}, "\n")
+}
+
+func (s HMAC) Sign(req request.Request, http_req *http.Request) error {
+	timestamp := strconv.FormatInt(s.config.clock().Unix(), 10)
+	signature := hmacSHA256(s.secret, s.StringToSign(req, http_req, timestamp))
+
+	if s.config.key_id != "" {
+		http_req.Header.Set(s.config.key_id_header, s.config.key_id)
+	}
+	http_req.Header.Set(s.config.timestamp_header, timestamp)
+	http_req.Header.Set(s.config.signature_header, hex.EncodeToString(signature))
+	return nil
+}
@@ -0,0 +1,78 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingSecret     = errors.New("signer secret is empty")
+	ErrMissingCredential = errors.New("signer access key, region and service are required")
+)
+
+type Clock func() time.Time
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes s per RFC 3986, leaving only unreserved characters (and
+// "/" unless encode_slash) as is.
+func uriEncode(s string, encode_slash bool) string {
+	const hex_digits = "0123456789ABCDEF"
+
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encode_slash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex_digits[c>>4])
+			b.WriteByte(hex_digits[c&0x0f])
+		}
+	}
+
+	return b.String()
+}
+
+func canonicalPath(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+
+	return uriEncode(path, false)
+}
+
+// canonicalQuery sorts the query by key then value and joins the escaped
+// pairs with "&".
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
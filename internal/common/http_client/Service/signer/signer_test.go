@@ -0,0 +1,208 @@
+package signer_test
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/response"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/retry"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/client"
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMAC(t *testing.T) {
+	t.Run("Test vector", func(t *testing.T) {
+		req, err := request.Build(
+			request.Post(),
+			request.Domain("https://api.partner.test"),
+			request.Path("/v1/orders"),
+			request.Json(struct {
+				Id int `json:"id"`
+			}{1}),
+		)
+		require.NoError(t, err)
+		http_req, err := http.NewRequest("POST", "https://api.partner.test/v1/orders?b=2&a=1", nil)
+		require.NoError(t, err)
+
+		s, err := signer.NewHMAC(
+			[]byte("topsecret"),
+			signer.KeyId("partner-a"),
+			signer.HMACClock(func() time.Time { return time.Unix(1700000000, 0) }),
+		)
+		require.NoError(t, err)
+		require.NoError(t, s.Sign(req, http_req))
+
+		assert.Equal(t, "partner-a", http_req.Header.Get("X-Key-Id"))
+		assert.Equal(t, "1700000000", http_req.Header.Get("X-Timestamp"))
+		assert.Equal(t, "ccc6fe713e146b4e7e5f814dcdb1c67fc6f3c663ded1a9b3efc03859e953c0ba", http_req.Header.Get("X-Signature"))
+	})
+
+	t.Run("Empty secret", func(t *testing.T) {
+		_, err := signer.NewHMAC(nil)
+		assert.ErrorIs(t, err, signer.ErrMissingSecret)
+	})
+
+	t.Run("Every retry attempt is signed again", func(t *testing.T) {
+		var mu sync.Mutex
+		var timestamps []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v1/orders", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			timestamps = append(timestamps, r.Header.Get("X-Timestamp"))
+			if len(timestamps) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		now := time.Unix(1700000000, 0)
+		s, err := signer.NewHMAC([]byte("topsecret"), signer.HMACClock(func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}))
+		require.NoError(t, err)
+
+		var data string
+		err = client.New("Orders").
+			Sign(s).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/v1/orders"),
+				),
+				client.OnDoRequest(
+					retry.Simple(3, 0, func(code int) bool { return code == http.StatusOK })...,
+				),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", data)
+		assert.Equal(t, []string{"1700000001", "1700000002", "1700000003"}, timestamps)
+	})
+}
+
+func TestSigV4(t *testing.T) {
+	// Example from the AWS documentation "Signature Version 4 signing process".
+	clock := func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	s, err := signer.NewSigV4(
+		"AKIDEXAMPLE",
+		"wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"us-east-1",
+		"iam",
+		signer.SigV4Clock(clock),
+	)
+	require.NoError(t, err)
+
+	newRequest := func(t *testing.T) *http.Request {
+		http_req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+		require.NoError(t, err)
+		http_req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		return http_req
+	}
+
+	t.Run("Signing key", func(t *testing.T) {
+		assert.Equal(t,
+			"c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9",
+			hex.EncodeToString(s.SigningKey(clock())),
+		)
+	})
+
+	t.Run("Authorization header", func(t *testing.T) {
+		http_req := newRequest(t)
+		require.NoError(t, s.Sign(request.Request{}, http_req))
+
+		assert.Equal(t, "20150830T123600Z", http_req.Header.Get("X-Amz-Date"))
+		assert.Equal(t,
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+				"SignedHeaders=content-type;host;x-amz-date, "+
+				"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+			http_req.Header.Get("Authorization"),
+		)
+	})
+
+	t.Run("Session token is signed", func(t *testing.T) {
+		temporary, err := signer.NewSigV4(
+			"AKIDEXAMPLE",
+			"wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			"us-east-1",
+			"iam",
+			signer.SigV4Clock(clock),
+			signer.SessionToken("session"),
+		)
+		require.NoError(t, err)
+
+		http_req := newRequest(t)
+		require.NoError(t, temporary.Sign(request.Request{}, http_req))
+
+		assert.Equal(t, "session", http_req.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.Contains(
+			http_req.Header.Get("Authorization"),
+			"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token,",
+		))
+	})
+
+	t.Run("Headers added by middlewares are signed", func(t *testing.T) {
+		var authorization string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v1/users", func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			w.Write([]byte("ok"))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		tenant := func(next client.Doer) client.Doer {
+			return client.DoerFunc(func(req *http.Request) (*http.Response, error) {
+				req.Header.Set("X-Amz-Meta-Tenant", "t1")
+				return next.Do(req)
+			})
+		}
+
+		var data string
+		err := client.New("Users").
+			Sign(s).
+			Use(tenant).
+			Register(
+				client.BeforeDoRequest(
+					request.Get(),
+					request.Domain(server.URL),
+					request.Path("/v1/users"),
+				),
+				client.OnDoRequest(retry.Default()...),
+				client.AfterDoRequest(
+					response.OnSuccess(
+						response.Decode(&data),
+					),
+					response.OnReject(),
+				),
+			).Send()
+
+		assert.NoError(t, err)
+		assert.Contains(t, authorization, "SignedHeaders=host;x-amz-date;x-amz-meta-tenant,")
+	})
+
+	t.Run("Missing credential", func(t *testing.T) {
+		_, err := signer.NewSigV4("", "secret", "us-east-1", "iam")
+		assert.ErrorIs(t, err, signer.ErrMissingCredential)
+	})
+}
@@ -0,0 +1,176 @@
+package signer
+
+import (
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Entity/request"
+)
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+type SigV4Config struct {
+	session_token        string
+	content_sha256       bool
+	single_encoding_path bool
+	clock                Clock
+}
+
+type SigV4Options func(SigV4Config) SigV4Config
+
+// SessionToken is sent as X-Amz-Security-Token for temporary credentials.
+func SessionToken(token string) SigV4Options {
+	return func(c SigV4Config) SigV4Config {
+		c.session_token = token
+		return c
+	}
+}
+
+// ContentSHA256 also sends the payload hash as X-Amz-Content-Sha256, which
+// S3 compatible upstreams require.
+func ContentSHA256() SigV4Options {
+	return func(c SigV4Config) SigV4Config {
+		c.content_sha256 = true
+		return c
+	}
+}
+
+// SingleEncodingPath encodes the path once instead of twice, as S3 expects.
+func SingleEncodingPath() SigV4Options {
+	return func(c SigV4Config) SigV4Config {
+		c.single_encoding_path = true
+		return c
+	}
+}
+
+func SigV4Clock(clock Clock) SigV4Options {
+	return func(c SigV4Config) SigV4Config {
+		c.clock = clock
+		return c
+	}
+}
+
+// SigV4 signs requests with AWS Signature Version 4. The host, content-type
+// and every x-amz-* header are signed.
+type SigV4 struct {
+	access_key string
+	secret_key string
+	region     string
+	service    string
+	config     SigV4Config
+}
+
+func NewSigV4(access_key, secret_key, region, service string, opts ...SigV4Options) (SigV4, error) {
+	if secret_key == "" {
+		return SigV4{}, ErrMissingSecret
+	}
+	if access_key == "" || region == "" || service == "" {
+		return SigV4{}, ErrMissingCredential
+	}
+
+	cfg := SigV4Config{clock: time.Now}
+	for _, opt := range opts {
+		cfg = opt(cfg)
+	}
+
+	return SigV4{
+		access_key: access_key,
+		secret_key: secret_key,
+		region:     region,
+		service:    service,
+		config:     cfg,
+	}, nil
+}
+
+func (s SigV4) Sign(req request.Request, http_req *http.Request) error {
+	now := s.config.clock().UTC()
+	amz_date := now.Format("20060102T150405Z")
+	scope := strings.Join([]string{now.Format("20060102"), s.region, s.service, "aws4_request"}, "/")
+
+	payload_hash := hashHex([]byte(req.GetBody()))
+	http_req.Header.Set("X-Amz-Date", amz_date)
+	if s.config.session_token != "" {
+		http_req.Header.Set("X-Amz-Security-Token", s.config.session_token)
+	}
+	if s.config.content_sha256 {
+		http_req.Header.Set("X-Amz-Content-Sha256", payload_hash)
+	}
+
+	canonical_request, signed_headers := s.CanonicalRequest(http_req, payload_hash)
+	string_to_sign := strings.Join([]string{
+		sigV4Algorithm,
+		amz_date,
+		scope,
+		hashHex([]byte(canonical_request)),
+	}, "\n")
+
+	signature := hmacSHA256(s.SigningKey(now), string_to_sign)
+	http_req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+s.access_key+"/"+scope+
+		", SignedHeaders="+signed_headers+
+		", Signature="+hex.EncodeToString(signature))
+	return nil
+}
+
+// SigningKey derives the key for the day of t.
+func (s SigV4) SigningKey(t time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.secret_key), t.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// CanonicalRequest returns the canonical request and the signed header list
+// of http_req.
+func (s SigV4) CanonicalRequest(http_req *http.Request, payload_hash string) (string, string) {
+	host := http_req.Host
+	if host == "" {
+		host = http_req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for key, values := range http_req.Header {
+		name := strings.ToLower(key)
+		if name != "content-type" && !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonical_headers := strings.Builder{}
+	for _, name := range names {
+		canonical_headers.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed_headers := strings.Join(names, ";")
+
+	path := canonicalPath(http_req.URL)
+	if !s.config.single_encoding_path {
+		path = uriEncode(http_req.URL.EscapedPath(), false)
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	return strings.Join([]string{
+		http_req.Method,
+		path,
+		canonicalQuery(http_req.URL),
+		canonical_headers.String(),
+		signed_headers,
+		payload_hash,
+	}, "\n"), signed_headers
+}
@@ -0,0 +1,369 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMissingKeyPair    = errors.New("client certificate and key must be provided together")
+	ErrLoadKeyPair       = errors.New("fail to load client certificate")
+	ErrLoadRootCA        = errors.New("fail to load root CA")
+	ErrInvalidMinVersion = errors.New("invalid minimum TLS version")
+	ErrInvalidPin        = errors.New("invalid SPKI pin, expect base64 encoded sha256")
+	ErrPinMismatch       = errors.New("no peer certificate matches the pinned SPKI hashes")
+)
+
+type Config struct {
+	cert_file string
+	key_file  string
+	cert_pem  []byte
+	key_pem   []byte
+
+	ca_files []string
+	ca_pems  [][]byte
+
+	min_version uint16
+	server_name string
+	pins        []string
+
+	// Loaded by New
+	loader    *certLoader
+	roots     *caLoader
+	pin_bytes [][]byte
+}
+
+type ConfigOptions func(Config) Config
+
+// ClientCertFile loads the client certificate from PEM files. The files are
+// checked on every handshake and reloaded when they change on disk.
+func ClientCertFile(cert_file, key_file string) ConfigOptions {
+	return func(c Config) Config {
+		c.cert_file = cert_file
+		c.key_file = key_file
+		return c
+	}
+}
+
+func ClientCertPEM(cert_pem, key_pem []byte) ConfigOptions {
+	return func(c Config) Config {
+		c.cert_pem = cert_pem
+		c.key_pem = key_pem
+		return c
+	}
+}
+
+// RootCAFile trusts the CA bundles in paths instead of the system pool. Like
+// the client certificate, they are reloaded when they change on disk.
+func RootCAFile(paths ...string) ConfigOptions {
+	return func(c Config) Config {
+		c.ca_files = append(c.ca_files, paths...)
+		return c
+	}
+}
+
+func RootCAPEM(pems ...[]byte) ConfigOptions {
+	return func(c Config) Config {
+		c.ca_pems = append(c.ca_pems, pems...)
+		return c
+	}
+}
+
+// MinVersion takes one of the tls.VersionTLS* constants.
+func MinVersion(version uint16) ConfigOptions {
+	return func(c Config) Config {
+		c.min_version = version
+		return c
+	}
+}
+
+// ServerName overrides the SNI and the name the server certificate is
+// verified against.
+func ServerName(name string) ConfigOptions {
+	return func(c Config) Config {
+		c.server_name = name
+		return c
+	}
+}
+
+// PinSPKI accepts base64 encoded sha256 hashes of the peer public key, with
+// or without the "sha256/" prefix. A connection is refused unless a
+// certificate of the verified chain, the root included, matches a pin.
+func PinSPKI(hashes ...string) ConfigOptions {
+	return func(c Config) Config {
+		c.pins = append(c.pins, hashes...)
+		return c
+	}
+}
+
+func New(opts ...ConfigOptions) (Config, error) {
+	c := Config{}
+	for _, opt := range opts {
+		c = opt(c)
+	}
+
+	checks := []func(*Config) error{
+		loadClientCert,
+		loadRootCAs,
+		checkMinVersion,
+		loadPins,
+	}
+	for _, check := range checks {
+		if err := check(&c); err != nil {
+			return Config{}, err
+		}
+	}
+
+	return c, nil
+}
+
+func loadClientCert(c *Config) error {
+	if (c.cert_file == "") != (c.key_file == "") || (c.cert_pem == nil) != (c.key_pem == nil) {
+		return ErrMissingKeyPair
+	}
+
+	switch {
+	case c.cert_file != "":
+		c.loader = &certLoader{cert_file: c.cert_file, key_file: c.key_file}
+		if _, err := c.loader.get(); err != nil {
+			return err
+		}
+	case c.cert_pem != nil:
+		cert, err := tls.X509KeyPair(c.cert_pem, c.key_pem)
+		if err != nil {
+			return fmt.Errorf("%w:%v", ErrLoadKeyPair, err)
+		}
+		c.loader = &certLoader{cert: &cert}
+	}
+
+	return nil
+}
+
+func loadRootCAs(c *Config) error {
+	if len(c.ca_files) == 0 && len(c.ca_pems) == 0 {
+		return nil
+	}
+
+	c.roots = &caLoader{files: c.ca_files, pems: c.ca_pems}
+	_, err := c.roots.get()
+	return err
+}
+
+func checkMinVersion(c *Config) error {
+	switch c.min_version {
+	case 0, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+		return nil
+	}
+
+	return fmt.Errorf("%w:%#x", ErrInvalidMinVersion, c.min_version)
+}
+
+func loadPins(c *Config) error {
+	for _, pin := range c.pins {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("%w:%s", ErrInvalidPin, pin)
+		}
+		c.pin_bytes = append(c.pin_bytes, b)
+	}
+
+	return nil
+}
+
+// SPKIHash returns the pin of cert in the format accepted by PinSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// TLSConfig builds the crypto/tls configuration for a transport. It is safe to
+// share the result between goroutines. The client certificate is reloaded on
+// every handshake, but the CA files are read as of this call: see
+// DialTLSContext.
+func (c Config) TLSConfig() *tls.Config {
+	t := &tls.Config{
+		MinVersion: c.min_version,
+		ServerName: c.server_name,
+	}
+	if t.MinVersion == 0 {
+		t.MinVersion = tls.VersionTLS12
+	}
+
+	if c.roots != nil {
+		// The pool read by New is kept when the files cannot be read.
+		t.RootCAs, _ = c.roots.get()
+	}
+
+	if c.loader != nil {
+		t.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.loader.get()
+		}
+	}
+
+	if len(c.pin_bytes) > 0 {
+		t.VerifyConnection = c.verifyPins
+	}
+
+	return t
+}
+
+// DialTLSContext opens a TLS connection with TLSConfig built afresh, so that
+// CA files rotated on disk are trusted without a restart. It fits
+// http.Transport.DialTLSContext.
+func (c Config) DialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	t := c.TLSConfig()
+	if t.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		t.ServerName = host
+	}
+
+	d := tls.Dialer{Config: t}
+	return d.DialContext(ctx, network, addr)
+}
+
+// verifyPins only looks at the verified chains: any certificate can be added
+// to the ones the server sends, a pinned one included.
+func (c Config) verifyPins(state tls.ConnectionState) error {
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range c.pin_bytes {
+				if string(sum[:]) == string(pin) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return ErrPinMismatch
+}
+
+type certLoader struct {
+	mu        sync.Mutex
+	cert_file string
+	key_file  string
+	mod_time  time.Time
+	cert      *tls.Certificate
+}
+
+func (l *certLoader) get() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cert_file == "" {
+		return l.cert, nil
+	}
+
+	mod_time, err := latestModTime(l.cert_file, l.key_file)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("%w:%v", ErrLoadKeyPair, err)
+	}
+
+	if l.cert != nil && mod_time.Equal(l.mod_time) {
+		return l.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.cert_file, l.key_file)
+	if err != nil {
+		// Keep serving the previous pair while a rotation is half written.
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("%w:%v", ErrLoadKeyPair, err)
+	}
+
+	l.cert = &cert
+	l.mod_time = mod_time
+	return l.cert, nil
+}
+
+// caLoader rebuilds the CA pool when a file of the bundle changes, keeping
+// the previous pool while a rotation is half written.
+type caLoader struct {
+	mu       sync.Mutex
+	files    []string
+	pems     [][]byte
+	mod_time time.Time
+	pool     *x509.CertPool
+}
+
+func (l *caLoader) get() (*x509.CertPool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mod_time, err := latestModTime(l.files...)
+	if err != nil {
+		if l.pool != nil {
+			return l.pool, nil
+		}
+		return nil, fmt.Errorf("%w:%v", ErrLoadRootCA, err)
+	}
+
+	if l.pool != nil && mod_time.Equal(l.mod_time) {
+		return l.pool, nil
+	}
+
+	pool, err := l.load()
+	if err != nil {
+		if l.pool != nil {
+			return l.pool, nil
+		}
+		return nil, err
+	}
+
+	l.pool = pool
+	l.mod_time = mod_time
+	return l.pool, nil
+}
+
+func (l *caLoader) load() (*x509.CertPool, error) {
+	pems := slices.Clone(l.pems)
+	for _, path := range l.files {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w:%v", ErrLoadRootCA, err)
+		}
+		pems = append(pems, b)
+	}
+
+	pool := x509.NewCertPool()
+	for _, pem := range pems {
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w:no certificate found in bundle", ErrLoadRootCA)
+		}
+	}
+
+	return pool, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,257 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/tlsconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type keyPair struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	cert_pem []byte
+	key_pem  []byte
+}
+
+func issue(t *testing.T, name string, parent *keyPair, usage x509.ExtKeyUsage) *keyPair {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signer_key := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signer_key = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signer_key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	key_der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &keyPair{
+		cert:     cert,
+		key:      key,
+		cert_pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key_pem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der}),
+	}
+}
+
+// mtlsServer answers with the common name of the client certificate. The
+// extra certificates are sent after the server one.
+func mtlsServer(t *testing.T, ca, server *keyPair, extra ...*keyPair) *httptest.Server {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	pair, err := tls.X509KeyPair(server.cert_pem, server.key_pem)
+	require.NoError(t, err)
+	for _, cert := range extra {
+		pair.Certificate = append(pair.Certificate, cert.cert.Raw)
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func get(cfg tlsconfig.Config, url string) (string, error) {
+	c := http.Client{Transport: &http.Transport{TLSClientConfig: cfg.TLSConfig()}}
+	resp, err := c.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := issue(t, "Test CA", nil, 0)
+	server := issue(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	partner := issue(t, "partner-a", ca, x509.ExtKeyUsageClientAuth)
+	s := mtlsServer(t, ca, server)
+
+	t.Run("Client certificate and private CA from memory", func(t *testing.T) {
+		cfg, err := tlsconfig.New(
+			tlsconfig.ClientCertPEM(partner.cert_pem, partner.key_pem),
+			tlsconfig.RootCAPEM(ca.cert_pem),
+			tlsconfig.MinVersion(tls.VersionTLS13),
+		)
+		require.NoError(t, err)
+
+		cn, err := get(cfg, s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "partner-a", cn)
+	})
+
+	t.Run("Missing client certificate is rejected by upstream", func(t *testing.T) {
+		cfg, err := tlsconfig.New(tlsconfig.RootCAPEM(ca.cert_pem))
+		require.NoError(t, err)
+
+		_, err = get(cfg, s.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("Server name override", func(t *testing.T) {
+		cfg, err := tlsconfig.New(
+			tlsconfig.ClientCertPEM(partner.cert_pem, partner.key_pem),
+			tlsconfig.RootCAPEM(ca.cert_pem),
+			tlsconfig.ServerName("not-localhost"),
+		)
+		require.NoError(t, err)
+
+		_, err = get(cfg, s.URL)
+		assert.ErrorContains(t, err, "not-localhost")
+	})
+
+	t.Run("SPKI pinning", func(t *testing.T) {
+		match, err := tlsconfig.New(
+			tlsconfig.ClientCertPEM(partner.cert_pem, partner.key_pem),
+			tlsconfig.RootCAPEM(ca.cert_pem),
+			tlsconfig.PinSPKI(tlsconfig.SPKIHash(server.cert)),
+		)
+		require.NoError(t, err)
+		_, err = get(match, s.URL)
+		assert.NoError(t, err)
+
+		mismatch, err := tlsconfig.New(
+			tlsconfig.ClientCertPEM(partner.cert_pem, partner.key_pem),
+			tlsconfig.RootCAPEM(ca.cert_pem),
+			tlsconfig.PinSPKI(tlsconfig.SPKIHash(partner.cert)),
+		)
+		require.NoError(t, err)
+		_, err = get(mismatch, s.URL)
+		assert.ErrorIs(t, err, tlsconfig.ErrPinMismatch)
+
+		// The pinned certificate is sent but is not part of the chain.
+		padded := mtlsServer(t, ca, server, partner)
+		_, err = get(mismatch, padded.URL)
+		assert.ErrorIs(t, err, tlsconfig.ErrPinMismatch)
+	})
+
+	t.Run("Reload client certificate when files change", func(t *testing.T) {
+		dir := t.TempDir()
+		cert_file := filepath.Join(dir, "client.crt")
+		key_file := filepath.Join(dir, "client.key")
+		ca_file := filepath.Join(dir, "ca.crt")
+		require.NoError(t, os.WriteFile(cert_file, partner.cert_pem, 0o600))
+		require.NoError(t, os.WriteFile(key_file, partner.key_pem, 0o600))
+		require.NoError(t, os.WriteFile(ca_file, ca.cert_pem, 0o600))
+
+		cfg, err := tlsconfig.New(
+			tlsconfig.ClientCertFile(cert_file, key_file),
+			tlsconfig.RootCAFile(ca_file),
+		)
+		require.NoError(t, err)
+
+		cn, err := get(cfg, s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "partner-a", cn)
+
+		rotated := issue(t, "partner-b", ca, x509.ExtKeyUsageClientAuth)
+		require.NoError(t, os.WriteFile(cert_file, rotated.cert_pem, 0o600))
+		require.NoError(t, os.WriteFile(key_file, rotated.key_pem, 0o600))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(cert_file, later, later))
+		require.NoError(t, os.Chtimes(key_file, later, later))
+
+		cn, err = get(cfg, s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "partner-b", cn)
+	})
+
+	t.Run("Reload CA bundle when it changes", func(t *testing.T) {
+		ca_file := filepath.Join(t.TempDir(), "ca.crt")
+		other := issue(t, "Other CA", nil, 0)
+		require.NoError(t, os.WriteFile(ca_file, other.cert_pem, 0o600))
+
+		cfg, err := tlsconfig.New(
+			tlsconfig.ClientCertPEM(partner.cert_pem, partner.key_pem),
+			tlsconfig.RootCAFile(ca_file),
+		)
+		require.NoError(t, err)
+		c := http.Client{Transport: &http.Transport{DialTLSContext: cfg.DialTLSContext, DisableKeepAlives: true}}
+
+		_, err = c.Get(s.URL)
+		assert.ErrorContains(t, err, "unknown authority")
+
+		require.NoError(t, os.WriteFile(ca_file, append(other.cert_pem, ca.cert_pem...), 0o600))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(ca_file, later, later))
+
+		resp, err := c.Get(s.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "partner-a", string(b))
+	})
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	t.Run("Certificate without key", func(t *testing.T) {
+		_, err := tlsconfig.New(tlsconfig.ClientCertFile("client.crt", ""))
+		assert.ErrorIs(t, err, tlsconfig.ErrMissingKeyPair)
+	})
+
+	t.Run("Unreadable CA bundle", func(t *testing.T) {
+		_, err := tlsconfig.New(tlsconfig.RootCAFile(filepath.Join(t.TempDir(), "missing.pem")))
+		assert.ErrorIs(t, err, tlsconfig.ErrLoadRootCA)
+	})
+
+	t.Run("Unknown TLS version", func(t *testing.T) {
+		_, err := tlsconfig.New(tlsconfig.MinVersion(0x0200))
+		assert.ErrorIs(t, err, tlsconfig.ErrInvalidMinVersion)
+	})
+
+	t.Run("Malformed pin", func(t *testing.T) {
+		_, err := tlsconfig.New(tlsconfig.PinSPKI("sha256/not-base64"))
+		assert.ErrorIs(t, err, tlsconfig.ErrInvalidPin)
+	})
+}
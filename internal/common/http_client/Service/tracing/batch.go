@@ -0,0 +1,225 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExporterFunc adapts a function to Exporter.
+type ExporterFunc func(ctx context.Context, spans []SpanData) error
+
+func (f ExporterFunc) Export(ctx context.Context, spans []SpanData) error {
+	return f(ctx, spans)
+}
+
+// Batcher queues spans and hands them to its exporter in batches from a
+// background goroutine, so that Span.End never waits on the exporter. Spans
+// arriving while the queue is full are dropped.
+type Batcher struct {
+	exporter Exporter
+	config   BatcherConfig
+
+	queue   chan SpanData
+	flushes chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+type BatcherConfig struct {
+	queue_size int
+	batch_size int
+	interval   time.Duration
+	timeout    time.Duration
+	on_error   func(error)
+}
+
+type BatcherOptions func(BatcherConfig) BatcherConfig
+
+// QueueSize bounds the spans waiting for export, 2048 by default.
+func QueueSize(n int) BatcherOptions {
+	return func(c BatcherConfig) BatcherConfig {
+		c.queue_size = n
+		return c
+	}
+}
+
+// BatchSize bounds the spans of one export, 512 by default.
+func BatchSize(n int) BatcherOptions {
+	return func(c BatcherConfig) BatcherConfig {
+		c.batch_size = n
+		return c
+	}
+}
+
+// BatchInterval is how long a span waits at most for its batch to fill, 5s
+// by default.
+func BatchInterval(d time.Duration) BatcherOptions {
+	return func(c BatcherConfig) BatcherConfig {
+		c.interval = d
+		return c
+	}
+}
+
+// ExportTimeout bounds every export, 10s by default.
+func ExportTimeout(d time.Duration) BatcherOptions {
+	return func(c BatcherConfig) BatcherConfig {
+		c.timeout = d
+		return c
+	}
+}
+
+// OnExportError receives the errors of background exports, which are
+// otherwise dropped.
+func OnExportError(fn func(error)) BatcherOptions {
+	return func(c BatcherConfig) BatcherConfig {
+		c.on_error = fn
+		return c
+	}
+}
+
+func NewBatcher(exporter Exporter, opts ...BatcherOptions) *Batcher {
+	config := BatcherConfig{
+		queue_size: 2048,
+		batch_size: 512,
+		interval:   5 * time.Second,
+		timeout:    10 * time.Second,
+	}
+	for _, opt := range opts {
+		config = opt(config)
+	}
+	config.batch_size = max(config.batch_size, 1)
+	if config.interval <= 0 {
+		config.interval = 5 * time.Second
+	}
+	if config.timeout <= 0 {
+		config.timeout = 10 * time.Second
+	}
+
+	b := &Batcher{
+		exporter: exporter,
+		config:   config,
+		queue:    make(chan SpanData, max(config.queue_size, 1)),
+		flushes:  make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+
+	return b
+}
+
+// Export queues spans without blocking. It never fails: spans that do not fit
+// are counted in Dropped.
+func (b *Batcher) Export(_ context.Context, spans []SpanData) error {
+	for _, s := range spans {
+		select {
+		case <-b.stop:
+			b.dropped.Add(1)
+			continue
+		default:
+		}
+
+		select {
+		case b.queue <- s:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+
+	return nil
+}
+
+// Dropped is the number of spans lost to a full queue or a shut down Batcher.
+func (b *Batcher) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Flush exports the queued spans and waits for it, or for ctx to be done.
+func (b *Batcher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case b.flushes <- done:
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans and stops the Batcher. Spans exported
+// afterwards are dropped.
+func (b *Batcher) Shutdown(ctx context.Context) error {
+	b.once.Do(func() { close(b.stop) })
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher) run() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.config.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, b.config.batch_size)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.config.timeout)
+		err := b.exporter.Export(ctx, batch)
+		cancel()
+		if err != nil && b.config.on_error != nil {
+			b.config.on_error(err)
+		}
+		batch = make([]SpanData, 0, b.config.batch_size)
+	}
+	add := func(s SpanData) {
+		batch = append(batch, s)
+		if len(batch) >= b.config.batch_size {
+			export()
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-b.queue:
+				add(s)
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-b.queue:
+			add(s)
+		case <-ticker.C:
+			export()
+		case done := <-b.flushes:
+			drain()
+			close(done)
+		case <-b.stop:
+			drain()
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Exporter receives finished spans. Export is called synchronously from
+// Span.End, so exporters doing I/O go behind a Batcher.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Memory keeps every exported span, which is enough for tests and debug
+// endpoints.
+type Memory struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Export(_ context.Context, spans []SpanData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func (m *Memory) Spans() []SpanData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.spans)
+}
+
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.spans = nil
+}
+
+// Writer writes one JSON line per span, e.g. to os.Stdout.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+type spanLine struct {
+	Service    string         `json:"service"`
+	Name       string         `json:"name"`
+	Kind       SpanKind       `json:"kind"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Start      time.Time      `json:"start"`
+	Duration   string         `json:"duration"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Status     StatusCode     `json:"status"`
+	Message    string         `json:"message,omitempty"`
+}
+
+func (w *Writer) Export(_ context.Context, spans []SpanData) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	enc := json.NewEncoder(w.w)
+	for _, s := range spans {
+		line := spanLine{
+			Service:    s.Service,
+			Name:       s.Name,
+			Kind:       s.Kind,
+			TraceID:    s.Context.TraceID.String(),
+			SpanID:     s.Context.SpanID.String(),
+			Start:      s.Start,
+			Duration:   s.End.Sub(s.Start).String(),
+			Attributes: s.Attributes,
+			Status:     s.Status,
+			Message:    s.Message,
+		}
+		if s.Parent.IsValid() {
+			line.ParentID = s.Parent.String()
+		}
+
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ErrExport = errors.New("export spans")
+
+// ScopeName identifies this package as the instrumentation scope in OTLP.
+const ScopeName = "github.com/sakamotoryou/api-agg-two/internal/common/http_client"
+
+// OTLP posts spans to a collector with the OTLP/HTTP JSON encoding. Spans are
+// sent in the background by a Batcher, so a slow collector never holds up
+// Span.End. It uses a plain http.Client so that its own calls are never
+// traced.
+type OTLP struct {
+	endpoint string
+	header   http.Header
+	client   *http.Client
+	batch    []BatcherOptions
+	batcher  *Batcher
+}
+
+type OTLPOptions func(OTLP) OTLP
+
+// OTLPHeader adds a header, e.g. an API key, to every export.
+func OTLPHeader(key, value string) OTLPOptions {
+	return func(o OTLP) OTLP {
+		o.header = o.header.Clone()
+		o.header.Add(key, value)
+		return o
+	}
+}
+
+// OTLPHTTPClient replaces the default client, which gives up after 10s.
+func OTLPHTTPClient(c *http.Client) OTLPOptions {
+	return func(o OTLP) OTLP {
+		o.client = c
+		return o
+	}
+}
+
+// OTLPBatch configures the Batcher of the exporter.
+func OTLPBatch(opts ...BatcherOptions) OTLPOptions {
+	return func(o OTLP) OTLP {
+		o.batch = append(o.batch[:len(o.batch):len(o.batch)], opts...)
+		return o
+	}
+}
+
+// NewOTLP exports to endpoint, the full traces URL such as
+// "http://localhost:4318/v1/traces".
+func NewOTLP(endpoint string, opts ...OTLPOptions) *OTLP {
+	o := OTLP{
+		endpoint: endpoint,
+		header:   http.Header{},
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	o.batcher = NewBatcher(ExporterFunc(o.send), o.batch...)
+
+	return &o
+}
+
+// Export queues spans for the next batch.
+func (o *OTLP) Export(ctx context.Context, spans []SpanData) error {
+	return o.batcher.Export(ctx, spans)
+}
+
+// Flush sends the queued spans and waits for it, or for ctx to be done.
+func (o *OTLP) Flush(ctx context.Context) error {
+	return o.batcher.Flush(ctx)
+}
+
+// Shutdown sends the queued spans and stops exporting.
+func (o *OTLP) Shutdown(ctx context.Context) error {
+	return o.batcher.Shutdown(ctx)
+}
+
+func (o *OTLP) send(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrExport, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrExport, err)
+	}
+	req.Header = o.header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w:%v", ErrExport, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%w:collector answered %d", ErrExport, resp.StatusCode)
+	}
+
+	return nil
+}
+
+type (
+	otlpExport struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string         `json:"traceId"`
+		SpanID       string         `json:"spanId"`
+		ParentSpanID string         `json:"parentSpanId,omitempty"`
+		TraceState   string         `json:"traceState,omitempty"`
+		Name         string         `json:"name"`
+		Kind         SpanKind       `json:"kind"`
+		Start        string         `json:"startTimeUnixNano"`
+		End          string         `json:"endTimeUnixNano"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+		Status       otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    StatusCode `json:"code"`
+		Message string     `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// otlpRequest groups spans by service, the only resource attribute kept.
+func otlpRequest(spans []SpanData) otlpExport {
+	by_service := map[string][]otlpSpan{}
+	services := []string{}
+	for _, s := range spans {
+		if _, ok := by_service[s.Service]; !ok {
+			services = append(services, s.Service)
+		}
+
+		span := otlpSpan{
+			TraceID:    s.Context.TraceID.String(),
+			SpanID:     s.Context.SpanID.String(),
+			TraceState: s.Context.State,
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Start:      strconv.FormatInt(s.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes: otlpAttributes(s.Attributes),
+			Status:     otlpStatus{s.Status, s.Message},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		by_service[s.Service] = append(by_service[s.Service], span)
+	}
+
+	export := otlpExport{}
+	for _, service := range services {
+		export.ResourceSpans = append(export.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: otlpAttributes(map[string]any{"service.name": service}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: ScopeName},
+				Spans: by_service[service],
+			}},
+		})
+	}
+
+	return export
+}
+
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, key := range keys {
+		out = append(out, otlpKeyValue{key, otlpValue(attrs[key])})
+	}
+
+	return out
+}
+
+// otlpValue encodes a value as an OTLP AnyValue. 64 bit integers are strings
+// in OTLP/JSON.
+func otlpValue(v any) map[string]any {
+	switch v := v.(type) {
+	case string:
+		return map[string]any{"stringValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case int:
+		return map[string]any{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	}
+
+	return map[string]any{"stringValue": fmt.Sprint(v)}
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent reads a version 00 traceparent header. Higher versions are
+// read the same way as the specification asks, ignoring extra fields.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	for _, field := range []struct {
+		src string
+		dst []byte
+	}{
+		{parts[1], sc.TraceID[:]},
+		{parts[2], sc.SpanID[:]},
+		{parts[3], flags[:]},
+	} {
+		if len(field.src) != 2*len(field.dst) || strings.ToLower(field.src) != field.src {
+			return SpanContext{}, ErrInvalidTraceparent
+		}
+		if _, err := hex.Decode(field.dst, []byte(field.src)); err != nil {
+			return SpanContext{}, fmt.Errorf("%w:%v", ErrInvalidTraceparent, err)
+		}
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	return sc, nil
+}
+
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// Inject writes the current span context of ctx as traceparent and
+// tracestate headers.
+func Inject(ctx context.Context, h http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		h.Set(TracestateHeader, sc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// Extract returns ctx carrying the span context found in inbound headers, so
+// that spans started from it join the caller's trace. Invalid headers are
+// ignored and a new trace starts instead.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+
+	sc.State = strings.Join(h.Values(TracestateHeader), ",")
+	sc.Remote = true
+	return ContextWithRemote(ctx, sc)
+}
+
+// Handler extracts the trace context of inbound requests and wraps next in a
+// server span, so that upstream calls made with the request context are its
+// children.
+func (t *Tracer) Handler(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := t.Start(Extract(r.Context(), r.Header), name, KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", rec.code)
+		if rec.code >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(rec.code)))
+		}
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// FlagSampled is the only trace flag defined by W3C Trace Context.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State is the raw tracestate header, passed along untouched.
+	State string
+	// Remote is set on contexts extracted from inbound headers.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+type SpanKind int
+
+// The values match OTLP.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type StatusCode int
+
+// The values match OTLP.
+const (
+	StatusUnset StatusCode = 0
+	StatusOk    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Service    string
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	Status     StatusCode
+	Message    string
+}
+
+// Span is an operation in progress. It is safe for concurrent use and
+// exported once, on the first End.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) Context() SpanContext {
+	return s.data.Context
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span failed. A nil err leaves it untouched.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Status = StatusError
+	s.data.Message = err.Error()
+}
+
+func (s *Span) SetOk() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Status == StatusUnset {
+		s.data.Status = StatusOk
+	}
+}
+
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.clock()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.Context.Sampled() {
+		s.tracer.exporter.Export(context.Background(), []SpanData{data})
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan makes s the parent of the spans started from ctx.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func SpanFromContext(ctx context.Context) (*Span, bool) {
+	s, ok := ctx.Value(spanKey{}).(*Span)
+	return s, ok
+}
+
+// ContextWithRemote stores a span context received from another process, as
+// Extract does.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext returns the current span context: the one of the
+// active span, else the remote one.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s, ok := SpanFromContext(ctx); ok {
+		return s.Context(), true
+	}
+
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+type Tracer struct {
+	service  string
+	exporter Exporter
+	clock    func() time.Time
+}
+
+type TracerOptions func(Tracer) Tracer
+
+func Clock(fn func() time.Time) TracerOptions {
+	return func(t Tracer) Tracer {
+		t.clock = fn
+		return t
+	}
+}
+
+// NewTracer creates spans for service and hands them to exporter once they
+// end. Spans of unsampled traces are propagated but not exported.
+func NewTracer(service string, exporter Exporter, opts ...TracerOptions) *Tracer {
+	t := Tracer{service: service, exporter: exporter, clock: time.Now}
+	for _, opt := range opts {
+		t = opt(t)
+	}
+
+	return &t
+}
+
+// Start begins a span, child of the current span of ctx if any, and returns
+// a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	sc := SpanContext{Flags: FlagSampled}
+	var parent SpanID
+	if p, ok := SpanContextFromContext(ctx); ok {
+		sc.TraceID = p.TraceID
+		sc.Flags = p.Flags
+		sc.State = p.State
+		parent = p.SpanID
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Service:    t.service,
+			Name:       name,
+			Kind:       kind,
+			Context:    sc,
+			Parent:     parent,
+			Start:      t.clock(),
+			Attributes: map[string]any{},
+		},
+	}
+
+	return ContextWithSpan(ctx, s), s
+}
@@ -0,0 +1,229 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sakamotoryou/api-agg-two/internal/common/http_client/Service/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropagation(t *testing.T) {
+	t.Run("Parse and format traceparent", func(t *testing.T) {
+		const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+		sc, err := tracing.ParseTraceparent(header)
+		require.NoError(t, err)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+		assert.True(t, sc.Sampled())
+		assert.Equal(t, header, sc.Traceparent())
+	})
+
+	t.Run("Reject invalid traceparent", func(t *testing.T) {
+		for _, header := range []string{
+			"",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		} {
+			_, err := tracing.ParseTraceparent(header)
+			assert.ErrorIs(t, err, tracing.ErrInvalidTraceparent, header)
+		}
+	})
+
+	t.Run("Inbound trace continues in child spans", func(t *testing.T) {
+		memory := tracing.NewMemory()
+		tracer := tracing.NewTracer("aggregator", memory)
+
+		var outgoing http.Header
+		handler := tracer.Handler("GET /rates", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, span := tracer.Start(r.Context(), "upstream", tracing.KindClient)
+			defer span.End()
+
+			outgoing = http.Header{}
+			tracing.Inject(tracing.ContextWithSpan(r.Context(), span), outgoing)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/rates", nil)
+		req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("Tracestate", "vendor=abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := memory.Spans()
+		require.Len(t, spans, 2)
+		upstream, server := spans[0], spans[1]
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.Context.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent.String())
+		assert.Equal(t, tracing.KindServer, server.Kind)
+		assert.Equal(t, server.Context.SpanID, upstream.Parent)
+		assert.Equal(t, upstream.Context.Traceparent(), outgoing.Get("Traceparent"))
+		assert.Equal(t, "vendor=abc", outgoing.Get("Tracestate"))
+	})
+
+	t.Run("Unsampled traces are propagated but not exported", func(t *testing.T) {
+		memory := tracing.NewMemory()
+		tracer := tracing.NewTracer("aggregator", memory)
+
+		h := http.Header{}
+		h.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		ctx, span := tracer.Start(tracing.Extract(context.Background(), h), "upstream", tracing.KindClient)
+		span.End()
+
+		out := http.Header{}
+		tracing.Inject(ctx, out)
+		assert.Empty(t, memory.Spans())
+		assert.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-00$", out.Get("Traceparent"))
+	})
+}
+
+func TestExporters(t *testing.T) {
+	t.Run("Writer prints one JSON line per span", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		tracer := tracing.NewTracer("aggregator", tracing.NewWriter(buf))
+
+		_, span := tracer.Start(context.Background(), "work", tracing.KindInternal)
+		span.SetAttribute("items", 3)
+		span.End()
+		span.End()
+
+		line := map[string]any{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+		assert.Equal(t, "work", line["name"])
+		assert.Equal(t, span.Context().TraceID.String(), line["trace_id"])
+		assert.EqualValues(t, 3, line["attributes"].(map[string]any)["items"])
+	})
+
+	t.Run("OTLP posts spans to the collector", func(t *testing.T) {
+		var received map[string]any
+		var api_key string
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/traces", r.URL.Path)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			api_key = r.Header.Get("X-Api-Key")
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+		defer collector.Close()
+
+		exporter := tracing.NewOTLP(collector.URL+"/v1/traces", tracing.OTLPHeader("X-Api-Key", "k1"))
+		tracer := tracing.NewTracer("aggregator", exporter)
+
+		ctx, parent := tracer.Start(context.Background(), "send", tracing.KindInternal)
+		_, child := tracer.Start(ctx, "attempt", tracing.KindClient)
+		child.SetAttribute("http.response.status_code", 200)
+		child.SetError(assert.AnError)
+		child.End()
+		require.NoError(t, exporter.Flush(context.Background()))
+
+		assert.Equal(t, "k1", api_key)
+
+		resource_spans := received["resourceSpans"].([]any)[0].(map[string]any)
+		assert.Equal(t,
+			[]any{map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "aggregator"}}},
+			resource_spans["resource"].(map[string]any)["attributes"],
+		)
+
+		span := resource_spans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+		assert.Equal(t, child.Context().TraceID.String(), span["traceId"])
+		assert.Equal(t, parent.Context().SpanID.String(), span["parentSpanId"])
+		assert.EqualValues(t, tracing.KindClient, span["kind"])
+		assert.EqualValues(t, tracing.StatusError, span["status"].(map[string]any)["code"])
+		assert.Equal(t,
+			[]any{map[string]any{"key": "http.response.status_code", "value": map[string]any{"intValue": "200"}}},
+			span["attributes"],
+		)
+	})
+
+	t.Run("OTLP reports collector failures", func(t *testing.T) {
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer collector.Close()
+
+		var err error
+		exporter := tracing.NewOTLP(collector.URL, tracing.OTLPBatch(tracing.OnExportError(func(e error) { err = e })))
+		defer exporter.Shutdown(context.Background())
+
+		require.NoError(t, exporter.Export(context.Background(), []tracing.SpanData{{Name: "work"}}))
+		require.NoError(t, exporter.Flush(context.Background()))
+		assert.ErrorIs(t, err, tracing.ErrExport)
+	})
+
+	t.Run("A hanging collector neither blocks spans nor exports", func(t *testing.T) {
+		release := make(chan struct{})
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer collector.Close()
+		defer close(release)
+
+		var err error
+		exporter := tracing.NewOTLP(collector.URL, tracing.OTLPBatch(
+			tracing.ExportTimeout(50*time.Millisecond),
+			tracing.OnExportError(func(e error) { err = e }),
+		))
+		defer exporter.Shutdown(context.Background())
+		tracer := tracing.NewTracer("aggregator", exporter)
+
+		start := time.Now()
+		for range 10 {
+			_, span := tracer.Start(context.Background(), "work", tracing.KindInternal)
+			span.End()
+		}
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+		require.NoError(t, exporter.Flush(context.Background()))
+		assert.ErrorIs(t, err, tracing.ErrExport)
+		assert.ErrorContains(t, err, "deadline exceeded")
+	})
+
+	t.Run("Batcher drops spans beyond its queue", func(t *testing.T) {
+		exporting, block := make(chan struct{}, 1), make(chan struct{})
+		memory := tracing.NewMemory()
+		batcher := tracing.NewBatcher(tracing.ExporterFunc(func(ctx context.Context, spans []tracing.SpanData) error {
+			select {
+			case exporting <- struct{}{}:
+			default:
+			}
+			<-block
+			return memory.Export(ctx, spans)
+		}), tracing.QueueSize(2), tracing.BatchSize(1))
+
+		batcher.Export(context.Background(), []tracing.SpanData{{Name: "first"}})
+		<-exporting
+		batcher.Export(context.Background(), []tracing.SpanData{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+		assert.EqualValues(t, 1, batcher.Dropped())
+
+		close(block)
+		require.NoError(t, batcher.Shutdown(context.Background()))
+		assert.Equal(t, "first", memory.Spans()[0].Name)
+		assert.Len(t, memory.Spans(), 3)
+
+		batcher.Export(context.Background(), []tracing.SpanData{{Name: "late"}})
+		assert.Len(t, memory.Spans(), 3)
+	})
+
+	t.Run("A zero export timeout falls back to the default", func(t *testing.T) {
+		var err error
+		batcher := tracing.NewBatcher(tracing.ExporterFunc(func(ctx context.Context, spans []tracing.SpanData) error {
+			return ctx.Err()
+		}), tracing.ExportTimeout(0), tracing.OnExportError(func(e error) { err = e }))
+		defer batcher.Shutdown(context.Background())
+
+		batcher.Export(context.Background(), []tracing.SpanData{{Name: "work"}})
+		require.NoError(t, batcher.Flush(context.Background()))
+		assert.NoError(t, err)
+	})
+}